@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/charmbracelet/log"
+	"github.com/krzko/restmigrate/internal/config"
 	"github.com/krzko/restmigrate/internal/executor"
 	"github.com/krzko/restmigrate/internal/logger"
 	"github.com/krzko/restmigrate/internal/migration"
@@ -41,6 +42,11 @@ func main() {
 				Usage:   "Path to migrations directory",
 				Value:   ".",
 			},
+			&cli.StringFlag{
+				Name:    "state",
+				Usage:   "State backend URL (file://, http(s)://, s3://) or gateway, defaults to restmigrate.state in the migrations path",
+				EnvVars: []string{"RESTMIGRATE_STATE"},
+			},
 		},
 		Before: func(cliCtx *cli.Context) error {
 			if cliCtx.Bool("debug") {
@@ -72,6 +78,28 @@ func main() {
 			return nil
 		},
 		Commands: []*cli.Command{
+			{
+				Name:  "baseline",
+				Usage: "Mark every pending migration up to and including a timestamp as applied without sending requests",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:     "at",
+						Usage:    "Timestamp or name of the last migration to mark as applied",
+						Required: true,
+					},
+					&cli.DurationFlag{
+						Name:  "lock-timeout",
+						Usage: "How long to wait for the state lock held by another run",
+					},
+					&cli.DurationFlag{
+						Name:  "lock-ttl",
+						Usage: "How long the state lock is honoured before another run may take it over, raised above --timeout when that is longer",
+						Value: migration.DefaultLockTTL,
+					},
+				}, concatFlags(apiFlags(), varFlags())...),
+				Before: config.Apply,
+				Action: wrapActionWithTelemetry(executor.Baseline),
+			},
 			{
 				Name:    "create",
 				Aliases: []string{"c"},
@@ -82,76 +110,250 @@ func main() {
 				Name:    "down",
 				Aliases: []string{"d", "rollback"},
 				Usage:   "Revert migration/s",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.BoolFlag{
 						Name:  "all",
 						Usage: "Revert all applied migrations",
 					},
 					&cli.StringFlag{
-						Name:     "base-url",
-						Aliases:  []string{"u"},
-						Usage:    "Base URL for the API",
-						EnvVars:  []string{"RESTMIGRATE_BASE_URL"},
-						Required: true,
+						Name:  "to",
+						Usage: "Revert the migrations applied after this timestamp or name, keeping it applied",
 					},
-					&cli.StringFlag{
-						Name:    "api-key",
-						Aliases: []string{"k"},
-						Usage:   "API Key for authentication",
-						EnvVars: []string{"RESTMIGRATE_API_KEY"},
+					&cli.IntFlag{
+						Name:  "steps",
+						Usage: "Revert the last N applied migrations",
 					},
-					&cli.StringFlag{
-						Name:    "type",
-						Aliases: []string{"t"},
-						Usage:   "API gateway type (apisix, kong, generic)",
-						Value:   "generic",
-						EnvVars: []string{"RESTMIGRATE_API_TYPE"},
+					&cli.DurationFlag{
+						Name:  "lock-timeout",
+						Usage: "How long to wait for the state lock held by another run",
 					},
-				},
+					&cli.DurationFlag{
+						Name:  "lock-ttl",
+						Usage: "How long the state lock is honoured before another run may take it over, raised above --timeout when that is longer",
+						Value: migration.DefaultLockTTL,
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "Overall timeout for sending the requests of migrations, 0 disables it",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Print the requests that would be sent without sending them or changing state",
+					},
+				}, concatFlags(apiFlags(), hookFlags(), varFlags())...),
+				Before: config.Apply,
 				Action: wrapActionWithTelemetry(executor.ExecuteDown),
 			},
+			{
+				Name:   "drift",
+				Usage:  "Compare the live resources of the API with the state left by applied migrations",
+				Flags:  concatFlags(apiFlags(), varFlags()),
+				Before: config.Apply,
+				Action: wrapActionWithTelemetry(executor.DetectDrift),
+			},
+			{
+				Name:   "force-unlock",
+				Usage:  "Remove the state lock left behind by an interrupted run",
+				Flags:  apiFlags(),
+				Before: config.Apply,
+				Action: wrapActionWithTelemetry(executor.ForceUnlock),
+			},
+			{
+				Name:  "import",
+				Usage: "Generate a baseline migration from the live configuration of a Kong or APISIX gateway and record it as applied",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: "Name of the generated migration",
+						Value: "baseline",
+					},
+				}, concatFlags(apiFlags(), varFlags())...),
+				Before: config.Apply,
+				Action: wrapActionWithTelemetry(executor.ImportResources),
+			},
 			{
 				Name:    "list",
 				Aliases: []string{"l"},
 				Usage:   "List all applied migrations",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:    "path",
 						Aliases: []string{"p"},
 						Usage:   "Path to migrations directory",
 						Value:   ".",
 					},
-				},
+				}, apiFlags()...),
+				Before: config.Apply,
 				Action: wrapActionWithTelemetry(executor.ListMigrations),
 			},
+			{
+				Name:      "mark-applied",
+				Usage:     "Mark a migration as applied without sending its requests",
+				ArgsUsage: "<timestamp|name>",
+				Flags: append([]cli.Flag{
+					&cli.DurationFlag{
+						Name:  "lock-timeout",
+						Usage: "How long to wait for the state lock held by another run",
+					},
+					&cli.DurationFlag{
+						Name:  "lock-ttl",
+						Usage: "How long the state lock is honoured before another run may take it over, raised above --timeout when that is longer",
+						Value: migration.DefaultLockTTL,
+					},
+				}, concatFlags(apiFlags(), varFlags())...),
+				Before: config.Apply,
+				Action: wrapActionWithTelemetry(executor.MarkApplied),
+			},
+			{
+				Name:      "mark-reverted",
+				Usage:     "Mark an applied migration as reverted without sending its down requests",
+				ArgsUsage: "<timestamp|name>",
+				Flags: append([]cli.Flag{
+					&cli.DurationFlag{
+						Name:  "lock-timeout",
+						Usage: "How long to wait for the state lock held by another run",
+					},
+					&cli.DurationFlag{
+						Name:  "lock-ttl",
+						Usage: "How long the state lock is honoured before another run may take it over, raised above --timeout when that is longer",
+						Value: migration.DefaultLockTTL,
+					},
+				}, concatFlags(apiFlags(), varFlags())...),
+				Before: config.Apply,
+				Action: wrapActionWithTelemetry(executor.MarkReverted),
+			},
+			{
+				Name:  "redo",
+				Usage: "Revert the last applied migration/s and apply them again",
+				Flags: append([]cli.Flag{
+					&cli.IntFlag{
+						Name:  "steps",
+						Usage: "Redo the last N applied migrations",
+						Value: 1,
+					},
+					&cli.BoolFlag{
+						Name:  "no-rollback",
+						Usage: "Leave already applied steps in place when a migration fails part way",
+					},
+					&cli.DurationFlag{
+						Name:  "lock-timeout",
+						Usage: "How long to wait for the state lock held by another run",
+					},
+					&cli.DurationFlag{
+						Name:  "lock-ttl",
+						Usage: "How long the state lock is honoured before another run may take it over, raised above --timeout when that is longer",
+						Value: migration.DefaultLockTTL,
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "Overall timeout for sending the requests of migrations, 0 disables it",
+					},
+					&cli.StringFlag{
+						Name:  "checksum-mismatch",
+						Usage: "Action when an applied migration that is not redone has been modified (fail, warn)",
+						Value: "fail",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Print the requests that would be sent without sending them or changing state",
+					},
+					&cli.BoolFlag{
+						Name:  "skip-verify",
+						Usage: "Do not run the verify checks of migrations once they are applied",
+					},
+				}, concatFlags(apiFlags(), hookFlags(), varFlags())...),
+				Before: config.Apply,
+				Action: wrapActionWithTelemetry(executor.ExecuteRedo),
+			},
+			{
+				Name:  "repair",
+				Usage: "Re-baseline the checksums of applied migrations",
+				Flags: append([]cli.Flag{
+					&cli.DurationFlag{
+						Name:  "lock-timeout",
+						Usage: "How long to wait for the state lock held by another run",
+					},
+					&cli.DurationFlag{
+						Name:  "lock-ttl",
+						Usage: "How long the state lock is honoured before another run may take it over, raised above --timeout when that is longer",
+						Value: migration.DefaultLockTTL,
+					},
+				}, concatFlags(apiFlags(), varFlags())...),
+				Before: config.Apply,
+				Action: wrapActionWithTelemetry(executor.RepairChecksums),
+			},
+			{
+				Name:    "status",
+				Aliases: []string{"s"},
+				Usage:   "Show applied, pending, missing and out of order migrations",
+				Flags: append([]cli.Flag{
+					&cli.BoolFlag{
+						Name:  "exit-code",
+						Usage: "Exit with a non-zero code if any migration is pending, missing or out of order",
+					},
+					&cli.StringFlag{
+						Name:  "checksum-mismatch",
+						Usage: "Action when an applied migration has been modified (fail, warn)",
+						Value: "fail",
+					},
+				}, append(apiFlags(), varFlags()...)...),
+				Before: config.Apply,
+				Action: wrapActionWithTelemetry(executor.ShowStatus),
+			},
 			{
 				Name:    "up",
 				Aliases: []string{"u"},
-				Usage:   "Apply all pending migrations",
-				Flags: []cli.Flag{
+				Usage:   "Apply pending migrations",
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
-						Name:     "base-url",
-						Aliases:  []string{"u"},
-						Usage:    "Base URL for the API",
-						EnvVars:  []string{"RESTMIGRATE_BASE_URL"},
-						Required: true,
+						Name:  "to",
+						Usage: "Apply pending migrations up to and including this timestamp or name",
 					},
-					&cli.StringFlag{
-						Name:    "api-key",
-						Aliases: []string{"k"},
-						Usage:   "API Key for authentication",
-						EnvVars: []string{"RESTMIGRATE_API_KEY"},
+					&cli.IntFlag{
+						Name:  "steps",
+						Usage: "Apply only the next N pending migrations",
+					},
+					&cli.BoolFlag{
+						Name:  "no-rollback",
+						Usage: "Leave already applied steps in place when a migration fails part way",
+					},
+					&cli.DurationFlag{
+						Name:  "lock-timeout",
+						Usage: "How long to wait for the state lock held by another run",
+					},
+					&cli.DurationFlag{
+						Name:  "lock-ttl",
+						Usage: "How long the state lock is honoured before another run may take it over, raised above --timeout when that is longer",
+						Value: migration.DefaultLockTTL,
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "Overall timeout for sending the requests of migrations, 0 disables it",
 					},
 					&cli.StringFlag{
-						Name:    "type",
-						Aliases: []string{"t"},
-						Usage:   "API gateway type (apisix, kong, generic)",
-						Value:   "generic",
-						EnvVars: []string{"RESTMIGRATE_API_TYPE"},
+						Name:  "checksum-mismatch",
+						Usage: "Action when an applied migration has been modified (fail, warn)",
+						Value: "fail",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Print the requests that would be sent without sending them or changing state",
+					},
+					&cli.BoolFlag{
+						Name:  "skip-verify",
+						Usage: "Do not run the verify checks of migrations once they are applied",
 					},
-				},
+				}, concatFlags(apiFlags(), hookFlags(), varFlags())...),
+				Before: config.Apply,
 				Action: wrapActionWithTelemetry(executor.ExecuteUp),
 			},
+			{
+				Name:   "verify",
+				Usage:  "Run the verify checks of applied migrations against the API",
+				Flags:  concatFlags(apiFlags(), varFlags()),
+				Before: config.Apply,
+				Action: wrapActionWithTelemetry(executor.VerifyMigrations),
+			},
 		},
 	}
 
@@ -170,6 +372,198 @@ func VersionString() string {
 	return fmt.Sprintf("%s (commit: %s, built: %s)", Version, Commit, Date)
 }
 
+// apiFlags returns the flags used to reach the target API, together with the
+// project file flags that can provide their values. The base URL is checked
+// by the commands that send requests, as it may come from an environment.
+func apiFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Usage:   "Project file defining environments, defaults to restmigrate.yaml, restmigrate.yml or restmigrate.cue",
+			EnvVars: []string{"RESTMIGRATE_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:    "env",
+			Aliases: []string{"e"},
+			Usage:   "Environment from the project file to run against",
+			EnvVars: []string{"RESTMIGRATE_ENV"},
+		},
+		&cli.StringFlag{
+			Name:    "base-url",
+			Aliases: []string{"u"},
+			Usage:   "Base URL for the API",
+			EnvVars: []string{"RESTMIGRATE_BASE_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "api-key",
+			Aliases: []string{"k"},
+			Usage:   "API Key for authentication",
+			EnvVars: []string{"RESTMIGRATE_API_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    "type",
+			Aliases: []string{"t"},
+			Usage:   "API gateway type (apisix, caddy, kong, krakend, traefik, tyk, generic)",
+			Value:   "generic",
+			EnvVars: []string{"RESTMIGRATE_API_TYPE"},
+		},
+		&cli.StringFlag{
+			Name:    "auth",
+			Usage:   "Authentication (none, bearer, basic, header, oauth2, sigv4), defaults to sending the API key the way the gateway type expects",
+			EnvVars: []string{"RESTMIGRATE_AUTH"},
+		},
+		&cli.StringFlag{
+			Name:    "auth-username",
+			Usage:   "Username for basic authentication",
+			EnvVars: []string{"RESTMIGRATE_AUTH_USERNAME"},
+		},
+		&cli.StringFlag{
+			Name:    "auth-password",
+			Usage:   "Password for basic authentication",
+			EnvVars: []string{"RESTMIGRATE_AUTH_PASSWORD"},
+		},
+		&cli.StringFlag{
+			Name:    "auth-header",
+			Usage:   "Header carrying the API key for header authentication",
+			EnvVars: []string{"RESTMIGRATE_AUTH_HEADER"},
+		},
+		&cli.StringFlag{
+			Name:    "oauth2-token-url",
+			Usage:   "Token endpoint for OAuth2 client credentials authentication",
+			EnvVars: []string{"RESTMIGRATE_OAUTH2_TOKEN_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "oauth2-client-id",
+			Usage:   "Client ID for OAuth2 client credentials authentication",
+			EnvVars: []string{"RESTMIGRATE_OAUTH2_CLIENT_ID"},
+		},
+		&cli.StringFlag{
+			Name:    "oauth2-client-secret",
+			Usage:   "Client secret for OAuth2 client credentials authentication",
+			EnvVars: []string{"RESTMIGRATE_OAUTH2_CLIENT_SECRET"},
+		},
+		&cli.StringFlag{
+			Name:    "oauth2-scopes",
+			Usage:   "Comma separated scopes requested with OAuth2 client credentials authentication",
+			EnvVars: []string{"RESTMIGRATE_OAUTH2_SCOPES"},
+		},
+		&cli.StringFlag{
+			Name:  "sigv4-region",
+			Usage: "AWS region for SigV4 signing, defaults to AWS_REGION, credentials are read from the AWS environment variables",
+		},
+		&cli.StringFlag{
+			Name:  "sigv4-service",
+			Usage: "AWS service name for SigV4 signing",
+			Value: "execute-api",
+		},
+		&cli.IntFlag{
+			Name:  "retry-max-attempts",
+			Usage: "Attempts per request when it fails with a connection error or a retryable status, 1 disables retries",
+			Value: 3,
+		},
+		&cli.DurationFlag{
+			Name:  "retry-initial-backoff",
+			Usage: "Wait before the first retry, doubled for each further retry",
+			Value: 500 * time.Millisecond,
+		},
+		&cli.DurationFlag{
+			Name:  "retry-max-backoff",
+			Usage: "Upper bound of the wait between retries",
+			Value: 30 * time.Second,
+		},
+		&cli.StringFlag{
+			Name:  "retry-status",
+			Usage: "Comma separated HTTP statuses that are retried",
+			Value: "429,502,503,504",
+		},
+		&cli.DurationFlag{
+			Name:  "request-timeout",
+			Usage: "Timeout of each attempt of a request, 0 disables it",
+			Value: 30 * time.Second,
+		},
+		&cli.StringFlag{
+			Name:    "tls-cert",
+			Usage:   "PEM client certificate for mutual TLS",
+			EnvVars: []string{"RESTMIGRATE_TLS_CERT"},
+		},
+		&cli.StringFlag{
+			Name:    "tls-key",
+			Usage:   "PEM private key of the client certificate",
+			EnvVars: []string{"RESTMIGRATE_TLS_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    "tls-ca",
+			Usage:   "PEM CA bundle trusted in addition to the system certificates",
+			EnvVars: []string{"RESTMIGRATE_TLS_CA"},
+		},
+		&cli.StringFlag{
+			Name:    "tls-server-name",
+			Usage:   "Server name the API certificate is verified against",
+			EnvVars: []string{"RESTMIGRATE_TLS_SERVER_NAME"},
+		},
+		&cli.StringFlag{
+			Name:    "tls-min-version",
+			Usage:   "Minimum TLS version (1.0, 1.1, 1.2, 1.3), defaults to 1.2",
+			EnvVars: []string{"RESTMIGRATE_TLS_MIN_VERSION"},
+		},
+		&cli.BoolFlag{
+			Name:    "insecure-skip-verify",
+			Usage:   "Skip verification of the API certificate, only for throwaway environments",
+			EnvVars: []string{"RESTMIGRATE_INSECURE_SKIP_VERIFY"},
+		},
+	}
+}
+
+// varFlags returns the flags used to inject variables into @tag() attributes
+// of migrations. RESTMIGRATE_VAR_<NAME> environment variables are read as well.
+func varFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "var",
+			Usage: "Set a migration variable as key=value, may be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "var-file",
+			Usage: "Read migration variables from a file of key=value lines, may be repeated",
+		},
+	}
+}
+
+// hookFlags returns the flags that configure what happens after each migration
+// is applied or reverted, for gateways that need a reload or time to converge.
+func hookFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "reload",
+			Usage:   "Request sent after each migration to reload the gateway, as \"METHOD /path\" or a path sent with POST",
+			EnvVars: []string{"RESTMIGRATE_RELOAD"},
+		},
+		&cli.StringFlag{
+			Name:    "health-path",
+			Usage:   "Path polled after each migration until it returns a 2xx status",
+			EnvVars: []string{"RESTMIGRATE_HEALTH_PATH"},
+		},
+		&cli.DurationFlag{
+			Name:  "health-interval",
+			Usage: "Interval between health checks",
+			Value: 2 * time.Second,
+		},
+		&cli.DurationFlag{
+			Name:  "health-timeout",
+			Usage: "How long to wait for the gateway to become healthy",
+			Value: time.Minute,
+		},
+	}
+}
+
+func concatFlags(sets ...[]cli.Flag) []cli.Flag {
+	var flags []cli.Flag
+	for _, set := range sets {
+		flags = append(flags, set...)
+	}
+	return flags
+}
+
 func wrapActionWithTelemetry(f func(context.Context, *cli.Context) error) cli.ActionFunc {
 	return func(c *cli.Context) error {
 		commandName := fmt.Sprintf("%s %s", appName, c.Command.Name)
@@ -0,0 +1,19 @@
+migrations: [
+    {
+        timestamp: 1719804900
+        name:      "tag_http_upstream"
+        up: steps: [
+            {
+                method: "PUT"
+                path:   "/config/apps/layer4/servers/socks/routes/1/handle/0/upstreams/0/@id"
+                body:   "http_upstream"
+            },
+        ]
+        down: steps: [
+            {
+                method: "DELETE"
+                path:   "/config/apps/layer4/servers/socks/routes/1/handle/0/upstreams/0/@id"
+            },
+        ]
+    },
+]
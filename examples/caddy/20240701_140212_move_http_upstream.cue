@@ -0,0 +1,30 @@
+migrations: [
+    {
+        timestamp: 1719806532
+        name:      "move_http_upstream"
+        up: steps: [
+            {
+                method: "PATCH"
+                path:   "@http_upstream/dial"
+                body: ["localhost:8081"]
+            },
+            {
+                method: "PATCH"
+                path:   "/config/apps/layer4/servers/socks/listen"
+                body: ["0.0.0.0:3001"]
+            },
+        ]
+        down: steps: [
+            {
+                method: "PATCH"
+                path:   "/config/apps/layer4/servers/socks/listen"
+                body: ["0.0.0.0:3000"]
+            },
+            {
+                method: "PATCH"
+                path:   "@http_upstream/dial"
+                body: ["localhost:8080"]
+            },
+        ]
+    },
+]
@@ -0,0 +1,39 @@
+import "encoding/base64"
+
+// Traefik reads its dynamic configuration from the Consul KV provider, the
+// transaction endpoint sets all keys of the router and service at once.
+_kv: {
+    "traefik/http/routers/whoami/rule":                        "Host(`whoami.localhost`)"
+    "traefik/http/routers/whoami/service":                     "whoami"
+    "traefik/http/services/whoami/loadbalancer/servers/0/url": "http://whoami:80"
+}
+
+migrations: [
+    {
+        timestamp: 1720001524
+        name:      "add_whoami_router"
+        up: steps: [
+            {
+                method: "PUT"
+                path:   "/v1/txn"
+                body: [for key, value in _kv {
+                    KV: {
+                        Verb:  "set"
+                        Key:   key
+                        Value: base64.Encode(null, value)
+                    }
+                }]
+            },
+        ]
+        down: steps: [
+            {
+                method: "PUT"
+                path:   "/v1/txn"
+                body: [
+                    {KV: {Verb: "delete-tree", Key: "traefik/http/routers/whoami"}},
+                    {KV: {Verb: "delete-tree", Key: "traefik/http/services/whoami"}},
+                ]
+            },
+        ]
+    },
+]
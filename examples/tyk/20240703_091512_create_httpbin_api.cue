@@ -0,0 +1,33 @@
+migrations: [
+    {
+        timestamp: 1719998112
+        name:      "create_httpbin_api"
+        up: steps: [
+            {
+                method: "POST"
+                path:   "/tyk/apis"
+                body: {
+                    api_id:      "httpbin"
+                    name:        "httpbin"
+                    use_keyless: true
+                    active:      true
+                    proxy: {
+                        listen_path:       "/httpbin/"
+                        target_url:        "http://httpbin.org/"
+                        strip_listen_path: true
+                    }
+                    version_data: {
+                        not_versioned: true
+                        versions: Default: name: "Default"
+                    }
+                }
+            },
+        ]
+        down: steps: [
+            {
+                method: "DELETE"
+                path:   "/tyk/apis/httpbin"
+            },
+        ]
+    },
+]
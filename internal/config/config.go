@@ -0,0 +1,286 @@
+// Package config loads the restmigrate project file, which defines named
+// environments so a run only needs --env to select its target.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFiles are looked up in the working directory when --config is not set.
+var DefaultFiles = []string{"restmigrate.yaml", "restmigrate.yml", "restmigrate.cue"}
+
+const metadataKey = "restmigrate.environment"
+
+type Project struct {
+	DefaultEnv   string                 `yaml:"default_env" json:"default_env"`
+	Environments map[string]Environment `yaml:"environments" json:"environments"`
+
+	// dir is the directory of the project file, relative paths in the
+	// environments are resolved against it.
+	dir string
+}
+
+// Environment holds the settings of a named environment. String values may
+// reference environment variables as ${NAME}, which keeps secrets out of the
+// project file. Relative paths are relative to the project file.
+type Environment struct {
+	BaseURL    string            `yaml:"base_url" json:"base_url"`
+	Type       string            `yaml:"type" json:"type"`
+	APIKey     string            `yaml:"api_key" json:"api_key"`
+	Path       string            `yaml:"path" json:"path"`
+	State      string            `yaml:"state" json:"state"`
+	Reload     string            `yaml:"reload" json:"reload"`
+	HealthPath string            `yaml:"health_path" json:"health_path"`
+	Auth       Auth              `yaml:"auth" json:"auth"`
+	TLS        TLS               `yaml:"tls" json:"tls"`
+	Vars       map[string]string `yaml:"vars" json:"vars"`
+	VarFiles   []string          `yaml:"var_files" json:"var_files"`
+}
+
+// Auth selects how requests to the environment are authenticated, see the
+// --auth flags.
+type Auth struct {
+	Type         string `yaml:"type" json:"type"`
+	Username     string `yaml:"username" json:"username"`
+	Password     string `yaml:"password" json:"password"`
+	Header       string `yaml:"header" json:"header"`
+	TokenURL     string `yaml:"token_url" json:"token_url"`
+	ClientID     string `yaml:"client_id" json:"client_id"`
+	ClientSecret string `yaml:"client_secret" json:"client_secret"`
+	Scopes       string `yaml:"scopes" json:"scopes"`
+	Region       string `yaml:"region" json:"region"`
+	Service      string `yaml:"service" json:"service"`
+}
+
+// TLS configures the connection to the environment, see the --tls flags.
+type TLS struct {
+	Cert               string `yaml:"cert" json:"cert"`
+	Key                string `yaml:"key" json:"key"`
+	CA                 string `yaml:"ca" json:"ca"`
+	ServerName         string `yaml:"server_name" json:"server_name"`
+	MinVersion         string `yaml:"min_version" json:"min_version"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" json:"insecure_skip_verify"`
+}
+
+// Load reads a project file, YAML or CUE depending on its extension.
+func Load(file string) (*Project, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project file: %w", err)
+	}
+
+	var project Project
+	switch filepath.Ext(file) {
+	case ".cue":
+		value := cuecontext.New().CompileBytes(data, cue.Filename(file))
+		if value.Err() != nil {
+			return nil, value.Err()
+		}
+		if err := value.Decode(&project); err != nil {
+			return nil, fmt.Errorf("failed to decode project file: %w", err)
+		}
+	default:
+		if err := yaml.Unmarshal(data, &project); err != nil {
+			return nil, fmt.Errorf("failed to decode project file: %w", err)
+		}
+	}
+
+	project.dir = filepath.Dir(file)
+	return &project, nil
+}
+
+// Environment returns the named environment with environment variables
+// expanded, falling back to the default environment when name is empty.
+func (p *Project) Environment(name string) (*Environment, error) {
+	if name == "" {
+		name = p.DefaultEnv
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	env, ok := p.Environments[name]
+	if !ok {
+		return nil, fmt.Errorf("environment %q is not defined, available: %s", name, strings.Join(p.names(), ", "))
+	}
+
+	env.BaseURL = os.ExpandEnv(env.BaseURL)
+	env.Type = os.ExpandEnv(env.Type)
+	env.APIKey = os.ExpandEnv(env.APIKey)
+	env.Path = p.resolve(os.ExpandEnv(env.Path))
+	env.State = os.ExpandEnv(env.State)
+	env.Reload = os.ExpandEnv(env.Reload)
+	env.HealthPath = os.ExpandEnv(env.HealthPath)
+	env.Auth = Auth{
+		Type:         os.ExpandEnv(env.Auth.Type),
+		Username:     os.ExpandEnv(env.Auth.Username),
+		Password:     os.ExpandEnv(env.Auth.Password),
+		Header:       os.ExpandEnv(env.Auth.Header),
+		TokenURL:     os.ExpandEnv(env.Auth.TokenURL),
+		ClientID:     os.ExpandEnv(env.Auth.ClientID),
+		ClientSecret: os.ExpandEnv(env.Auth.ClientSecret),
+		Scopes:       os.ExpandEnv(env.Auth.Scopes),
+		Region:       os.ExpandEnv(env.Auth.Region),
+		Service:      os.ExpandEnv(env.Auth.Service),
+	}
+	env.TLS.Cert = p.resolve(os.ExpandEnv(env.TLS.Cert))
+	env.TLS.Key = p.resolve(os.ExpandEnv(env.TLS.Key))
+	env.TLS.CA = p.resolve(os.ExpandEnv(env.TLS.CA))
+	env.TLS.ServerName = os.ExpandEnv(env.TLS.ServerName)
+	env.TLS.MinVersion = os.ExpandEnv(env.TLS.MinVersion)
+	// env is a copy, but its map and slice are shared with the project and
+	// must not be expanded in place.
+	vars := make(map[string]string, len(env.Vars))
+	for key, value := range env.Vars {
+		vars[key] = os.ExpandEnv(value)
+	}
+	env.Vars = vars
+	varFiles := make([]string, len(env.VarFiles))
+	for i, file := range env.VarFiles {
+		varFiles[i] = p.resolve(os.ExpandEnv(file))
+	}
+	env.VarFiles = varFiles
+	return &env, nil
+}
+
+// resolve returns path relative to the directory of the project file.
+func (p *Project) resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(p.dir, path)
+}
+
+func (p *Project) names() []string {
+	names := make([]string, 0, len(p.Environments))
+	for name := range p.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flagValues maps the settings of the environment to the flags they default.
+func (e *Environment) flagValues() map[string]string {
+	insecureSkipVerify := ""
+	if e.TLS.InsecureSkipVerify {
+		insecureSkipVerify = "true"
+	}
+
+	return map[string]string{
+		"base-url":    e.BaseURL,
+		"type":        e.Type,
+		"api-key":     e.APIKey,
+		"path":        e.Path,
+		"state":       e.State,
+		"reload":      e.Reload,
+		"health-path": e.HealthPath,
+
+		"auth":                 e.Auth.Type,
+		"auth-username":        e.Auth.Username,
+		"auth-password":        e.Auth.Password,
+		"auth-header":          e.Auth.Header,
+		"oauth2-token-url":     e.Auth.TokenURL,
+		"oauth2-client-id":     e.Auth.ClientID,
+		"oauth2-client-secret": e.Auth.ClientSecret,
+		"oauth2-scopes":        e.Auth.Scopes,
+		"sigv4-region":         e.Auth.Region,
+		"sigv4-service":        e.Auth.Service,
+
+		"tls-cert":             e.TLS.Cert,
+		"tls-key":              e.TLS.Key,
+		"tls-ca":               e.TLS.CA,
+		"tls-server-name":      e.TLS.ServerName,
+		"tls-min-version":      e.TLS.MinVersion,
+		"insecure-skip-verify": insecureSkipVerify,
+	}
+}
+
+// Apply loads the project file and selected environment, and uses its
+// settings for every flag that was not set on the command line or through an
+// environment variable. It is meant to run as the Before hook of a command.
+func Apply(c *cli.Context) error {
+	file := c.String("config")
+	if file == "" {
+		file = findDefault()
+	}
+	if file == "" {
+		if c.String("env") != "" {
+			return fmt.Errorf("--env requires a project file, none of %s found", strings.Join(DefaultFiles, ", "))
+		}
+		return nil
+	}
+
+	project, err := Load(file)
+	if err != nil {
+		return err
+	}
+
+	env, err := project.Environment(c.String("env"))
+	if err != nil {
+		return err
+	}
+	if env == nil {
+		logger.Debug("No environment selected", "config", file)
+		return nil
+	}
+
+	logger.Debug("Using environment", "config", file, "env", c.String("env"))
+	for name, value := range env.flagValues() {
+		if value == "" || c.IsSet(name) || !hasFlag(c, name) {
+			continue
+		}
+		if err := c.Set(name, value); err != nil {
+			return fmt.Errorf("failed to apply %s from environment: %w", name, err)
+		}
+	}
+
+	c.App.Metadata[metadataKey] = env
+	return nil
+}
+
+// FromContext returns the environment applied to the command, or nil.
+func FromContext(c *cli.Context) *Environment {
+	env, _ := c.App.Metadata[metadataKey].(*Environment)
+	return env
+}
+
+// hasFlag reports whether the command or one of its parents defines name.
+func hasFlag(c *cli.Context, name string) bool {
+	for _, ctx := range c.Lineage() {
+		var flags []cli.Flag
+		if ctx.Command != nil {
+			flags = append(flags, ctx.Command.Flags...)
+		}
+		if ctx.App != nil {
+			flags = append(flags, ctx.App.Flags...)
+		}
+		for _, f := range flags {
+			for _, n := range f.Names() {
+				if n == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func findDefault() string {
+	for _, file := range DefaultFiles {
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEnvironmentResolvesPaths(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "restmigrate.yaml")
+	err := os.WriteFile(file, []byte(`
+default_env: prod
+environments:
+  prod:
+    path: migrations
+    var_files: [vars/prod.env, /etc/restmigrate/shared.env]
+    vars:
+      upstream_host: ${UPSTREAM_HOST}
+      db_password: ${DB_PASSWORD}
+    tls:
+      cert: ${CERT_DIR}/client.pem
+      key: certs/client-key.pem
+      ca: /etc/ssl/ca.pem
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CERT_DIR", "certs")
+	t.Setenv("UPSTREAM_HOST", "httpbin.internal")
+	// Expanding the value a second time would turn it into p@.
+	t.Setenv("DB_PASSWORD", "p@$word")
+
+	project, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Environment is called once per command, the paths must not be
+	// resolved twice.
+	for i := 0; i < 2; i++ {
+		env, err := project.Environment("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(dir, "migrations"); env.Path != want {
+			t.Errorf("path = %s, want %s", env.Path, want)
+		}
+		wantVarFiles := []string{filepath.Join(dir, "vars/prod.env"), "/etc/restmigrate/shared.env"}
+		if !reflect.DeepEqual(env.VarFiles, wantVarFiles) {
+			t.Errorf("var_files = %v, want %v", env.VarFiles, wantVarFiles)
+		}
+		if want := filepath.Join(dir, "certs/client.pem"); env.TLS.Cert != want {
+			t.Errorf("tls cert = %s, want %s", env.TLS.Cert, want)
+		}
+		if want := filepath.Join(dir, "certs/client-key.pem"); env.TLS.Key != want {
+			t.Errorf("tls key = %s, want %s", env.TLS.Key, want)
+		}
+		wantVars := map[string]string{"upstream_host": "httpbin.internal", "db_password": "p@$word"}
+		if !reflect.DeepEqual(env.Vars, wantVars) {
+			t.Errorf("vars = %v, want %v", env.Vars, wantVars)
+		}
+		if env.TLS.CA != "/etc/ssl/ca.pem" {
+			t.Errorf("tls ca = %s, want it unchanged", env.TLS.CA)
+		}
+	}
+}
+
+func TestEnvironmentUnknown(t *testing.T) {
+	project := &Project{Environments: map[string]Environment{"prod": {}, "dev": {}}}
+	if _, err := project.Environment("staging"); err == nil || err.Error() != `environment "staging" is not defined, available: dev, prod` {
+		t.Errorf("got %v", err)
+	}
+}
@@ -1,31 +1,281 @@
 package cue
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 
 	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/ast/astutil"
 	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/format"
 	"cuelang.org/go/cue/load"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
 	"github.com/krzko/restmigrate/internal/migration"
 )
 
-func ParseMigration(filename string) ([]migration.Migration, error) {
+// ParseMigration parses the migrations in filename. Values in vars are
+// injected into fields marked with a matching @tag(name) attribute, vars that
+// the file does not declare are ignored.
+func ParseMigration(filename string, vars map[string]string) ([]migration.Migration, error) {
+	tags, err := fileTags(filename, vars)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx := cuecontext.New()
-	instances := load.Instances([]string{filename}, nil)
+	value, err := build(ctx, filename, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	// The checksums are taken before the variables are injected.
+	source := value
+	if len(tags) > 0 {
+		source, err = build(ctx, filename, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	list := value.LookupPath(cue.ParsePath("migrations"))
+	var migrations []migration.Migration
+	err = list.Decode(&migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range migrations {
+		if err := migrations[i].Validate(); err != nil {
+			return nil, fmt.Errorf("invalid migration %s: %w", migrations[i].Name, err)
+		}
+		checks, err := parseChecks(list.LookupPath(cue.MakePath(cue.Index(i), cue.Str("verify"))))
+		if err != nil {
+			return nil, fmt.Errorf("invalid verify of %s: %w", migrations[i].Name, err)
+		}
+		migrations[i].Verify = checks
+
+		migrations[i].Source, err = checksumSource(source.LookupPath(cue.MakePath(cue.Str("migrations"), cue.Index(i))))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read source of %s: %w", migrations[i].Name, err)
+		}
+	}
+
+	return migrations, nil
+}
+
+// build loads filename with tags and builds its value.
+func build(ctx *cue.Context, filename string, tags []string) (cue.Value, error) {
+	instances := load.Instances([]string{filename}, &load.Config{Tags: tags})
 	if len(instances) == 0 {
-		return nil, fmt.Errorf("no instances found")
+		return cue.Value{}, fmt.Errorf("no instances found")
+	}
+	if instances[0].Err != nil {
+		return cue.Value{}, instances[0].Err
+	}
+	for _, file := range instances[0].Files {
+		bindResponse(file)
 	}
 
 	value := ctx.BuildInstance(instances[0])
 	if value.Err() != nil {
-		return nil, value.Err()
+		return cue.Value{}, value.Err()
 	}
+	return value, nil
+}
 
-	var migrations []migration.Migration
-	err := value.LookupPath(cue.ParsePath("migrations")).Decode(&migrations)
+// bindResponse declares `body: _` in verify checks that have assert but no
+// body, so that their assertions can reference the response body, which is
+// only filled in when the check runs.
+func bindResponse(file *ast.File) {
+	bound := false
+	ast.Walk(file, func(n ast.Node) bool {
+		field, ok := n.(*ast.Field)
+		if !ok || fieldName(field) != "verify" {
+			return true
+		}
+		list, ok := field.Value.(*ast.ListLit)
+		if !ok {
+			return true
+		}
+		for _, elt := range list.Elts {
+			check, ok := elt.(*ast.StructLit)
+			if !ok || !hasField(check, "assert") || hasField(check, "body") {
+				continue
+			}
+			check.Elts = append(check.Elts, &ast.Field{Label: ast.NewIdent("body"), Value: ast.NewIdent("_")})
+			bound = true
+		}
+		return false
+	}, nil)
+
+	if bound {
+		// The parser left the references to body unresolved. References
+		// that are still unresolved are reported when the value is built.
+		astutil.Resolve(file, func(token.Pos, string, ...interface{}) {})
+	}
+}
+
+func hasField(s *ast.StructLit, name string) bool {
+	for _, elt := range s.Elts {
+		if field, ok := elt.(*ast.Field); ok && fieldName(field) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldName(field *ast.Field) string {
+	name, _, _ := ast.LabelName(field.Label)
+	return name
+}
+
+// parseChecks reads the verify list of a migration. The checks keep their CUE
+// value, as the constraints on the response are not concrete JSON.
+func parseChecks(v cue.Value) ([]migration.Check, error) {
+	if !v.Exists() {
+		return nil, nil
+	}
+
+	iter, err := v.List()
 	if err != nil {
 		return nil, err
 	}
 
-	return migrations, nil
+	var checks []migration.Check
+	for i := 0; iter.Next(); i++ {
+		check, err := migration.NewCheck(iter.Value())
+		if err != nil {
+			return nil, fmt.Errorf("check %d: %w", i, err)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// checksumSource returns the up and down blocks of the migration v without
+// injected variables. Blocks that are concrete without them are normalised to
+// JSON, which is what Migration.Checksum hashes for them anyway. Blocks that
+// reference variables are rendered as CUE, with the variables left as their
+// declared type or default.
+func checksumSource(v cue.Value) ([]byte, error) {
+	var actions struct {
+		Up   migration.Actions `json:"up"`
+		Down migration.Actions `json:"down"`
+	}
+	if err := v.Decode(&actions); err == nil {
+		return json.Marshal(actions)
+	}
+
+	var source []byte
+	for _, block := range []string{"up", "down"} {
+		data, err := format.Node(v.LookupPath(cue.ParsePath(block)).Syntax(cue.Final()))
+		if err != nil {
+			return nil, err
+		}
+		source = append(source, block+": "...)
+		source = append(source, data...)
+		source = append(source, '\n')
+	}
+	return source, nil
+}
+
+// fileTags returns the key=value tags for the @tag attributes declared in
+// filename. CUE rejects tags that no file declares, so only those are passed.
+func fileTags(filename string, vars map[string]string) ([]string, error) {
+	if len(vars) == 0 {
+		return nil, nil
+	}
+
+	file, err := parser.ParseFile(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	declared := make(map[string]bool)
+	ast.Walk(file, func(n ast.Node) bool {
+		field, ok := n.(*ast.Field)
+		if !ok {
+			return true
+		}
+		for _, attr := range field.Attrs {
+			key, body := attr.Split()
+			if key != "tag" {
+				continue
+			}
+			name := strings.TrimSpace(strings.SplitN(body, ",", 2)[0])
+			declared[name] = true
+		}
+		return true
+	}, nil)
+
+	var tags []string
+	for name, value := range vars {
+		if declared[name] {
+			tags = append(tags, fmt.Sprintf("%s=%s", name, value))
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// FormatMigration renders m as the content of a migration file.
+func FormatMigration(m migration.Migration) ([]byte, error) {
+	for _, actions := range []*migration.Actions{&m.Up, &m.Down} {
+		steps := make([]migration.Step, len(actions.Steps))
+		for i, step := range actions.Steps {
+			step.Body = literal(step.Body)
+			steps[i] = step
+		}
+		actions.Steps = steps
+	}
+
+	value := cuecontext.New().Encode(map[string]interface{}{
+		"migrations": []migration.Migration{m},
+	})
+	if value.Err() != nil {
+		return nil, value.Err()
+	}
+
+	node, ok := value.Syntax(cue.Final(), cue.Concrete(true)).(*ast.StructLit)
+	if !ok {
+		return nil, fmt.Errorf("unexpected syntax for migration %s", m.Name)
+	}
+	return format.Node(&ast.File{Decls: node.Elts}, format.Simplify())
+}
+
+// literal converts JSON numbers in v to integers where possible, which CUE
+// would otherwise render as strings or in exponent notation.
+func literal(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			converted[key] = literal(value)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, value := range v {
+			converted[i] = literal(value)
+		}
+		return converted
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+		return v
+	default:
+		return v
+	}
 }
@@ -0,0 +1,171 @@
+package cue
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/krzko/restmigrate/internal/migration"
+)
+
+const taggedMigration = `
+upstream_host: string @tag(upstream_host)
+port:          *80 | int @tag(port,type=int)
+token:         string @tag(token)
+
+migrations: [
+	{
+		timestamp: 1719831943
+		name:      "create_upstream"
+		up: steps: [{
+			method: "PUT"
+			path:   "/upstreams/1"
+			body: nodes: "\(upstream_host):\(port)": 1
+			headers: Authorization: "Bearer \(token)"
+		}]
+		down: steps: [{method: "DELETE", path: "/upstreams/1"}]
+	},
+]
+`
+
+func writeMigration(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "20240701_110543_create_upstream.cue")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func parseOne(t *testing.T, filename string, vars map[string]string) migration.Migration {
+	t.Helper()
+	migrations, err := ParseMigration(filename, vars)
+	if err != nil {
+		t.Fatalf("ParseMigration: %v", err)
+	}
+	if len(migrations) != 1 {
+		t.Fatalf("got %d migrations, want 1", len(migrations))
+	}
+	return migrations[0]
+}
+
+func checksum(t *testing.T, m migration.Migration) string {
+	t.Helper()
+	sum, err := m.Checksum()
+	if err != nil {
+		t.Fatalf("Checksum: %v", err)
+	}
+	return sum
+}
+
+func TestParseMigrationInjectsVars(t *testing.T) {
+	filename := writeMigration(t, taggedMigration)
+	m := parseOne(t, filename, map[string]string{
+		"upstream_host": "httpbin.org",
+		"port":          "8080",
+		"token":         "s3cret",
+		"unused":        "ignored",
+	})
+
+	step := m.Up.Steps[0]
+	nodes := step.Body.(map[string]interface{})["nodes"].(map[string]interface{})
+	if _, ok := nodes["httpbin.org:8080"]; !ok {
+		t.Errorf("nodes = %v, want httpbin.org:8080", nodes)
+	}
+	if got := step.Headers["Authorization"]; got != "Bearer s3cret" {
+		t.Errorf("Authorization = %q", got)
+	}
+}
+
+func TestChecksumIgnoresVars(t *testing.T) {
+	filename := writeMigration(t, taggedMigration)
+	staging := parseOne(t, filename, map[string]string{"upstream_host": "staging.internal", "token": "a"})
+	prod := parseOne(t, filename, map[string]string{"upstream_host": "prod.internal", "port": "443", "token": "b"})
+
+	if checksum(t, staging) != checksum(t, prod) {
+		t.Error("checksum changed with the injected variables")
+	}
+	for _, secret := range []string{"staging.internal", "prod.internal"} {
+		if strings.Contains(string(prod.Source), secret) || strings.Contains(string(staging.Source), secret) {
+			t.Errorf("checksum source contains the variable value %s", secret)
+		}
+	}
+
+	edited := writeMigration(t, strings.Replace(taggedMigration, `path:   "/upstreams/1"`, `path:   "/upstreams/2"`, 1))
+	if checksum(t, parseOne(t, edited, map[string]string{"upstream_host": "prod.internal", "port": "443", "token": "b"})) == checksum(t, prod) {
+		t.Error("checksum did not change with the migration")
+	}
+}
+
+func TestChecksumWithoutVarsIsUnchanged(t *testing.T) {
+	filename := writeMigration(t, `
+migrations: [
+	{
+		timestamp: 1719831943
+		name:      "create_upstream"
+		up: steps: [{method: "PUT", path: "/upstreams/1", body: {type: "roundrobin", retries: 3}}]
+		down: steps: [{method: "DELETE", path: "/upstreams/1"}]
+	},
+]
+`)
+	m := parseOne(t, filename, nil)
+
+	// Checksums recorded before the source was hashed stay valid.
+	legacy := m
+	legacy.Source = nil
+	if checksum(t, m) != checksum(t, legacy) {
+		t.Error("checksum of a migration without variables changed")
+	}
+}
+
+func TestParseMigrationAssertOnlyCheck(t *testing.T) {
+	filename := writeMigration(t, `
+import "list"
+
+migrations: [
+	{
+		timestamp: 1719831943
+		name:      "create_upstream"
+		up: steps: [{method: "PUT", path: "/upstreams/1", body: nodes: "localhost:80": 1}]
+		down: steps: [{method: "DELETE", path: "/upstreams/1"}]
+		verify: [
+			{
+				path: "/upstreams/1"
+				assert: [body.enabled == true, list.Contains(body.tags, "prod")]
+			},
+			{
+				path: "/upstreams/1"
+				body: type: "roundrobin"
+				assert: [body.type == "roundrobin"]
+			},
+			{path: "/upstreams/1"},
+		]
+	},
+]
+`)
+	m := parseOne(t, filename, nil)
+	if len(m.Verify) != 3 {
+		t.Fatalf("got %d checks, want 3", len(m.Verify))
+	}
+
+	tests := []struct {
+		check   int
+		body    string
+		wantErr bool
+	}{
+		{check: 0, body: `{"enabled": true, "tags": ["prod"]}`},
+		{check: 0, body: `{"enabled": false, "tags": ["prod"]}`, wantErr: true},
+		{check: 0, body: `{"enabled": true, "tags": []}`, wantErr: true},
+		{check: 1, body: `{"type": "roundrobin"}`},
+		{check: 1, body: `{"type": "chash"}`, wantErr: true},
+		// A check without body and assert only checks the status.
+		{check: 2, body: `not json`},
+	}
+	for _, tt := range tests {
+		err := m.Verify[tt.check].Evaluate([]byte(tt.body))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("check %d with %s: got %v, want error %t", tt.check, tt.body, err, tt.wantErr)
+		}
+	}
+}
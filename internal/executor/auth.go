@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/krzko/restmigrate/internal/sigv4"
+	client "github.com/krzko/restmigrate/pkg/rest"
+	"github.com/urfave/cli/v2"
+)
+
+// authenticatorKey holds the authenticator of the run in the app metadata.
+const authenticatorKey = "restmigrate.authenticator"
+
+// authenticator returns the authenticator selected with --auth. It is created
+// once per run and shared by every client of the target API, so an OAuth2
+// token is requested once rather than by each client.
+func authenticator(c *cli.Context) (client.Authenticator, error) {
+	if auth, ok := c.App.Metadata[authenticatorKey].(client.Authenticator); ok {
+		return auth, nil
+	}
+
+	auth, err := newAuthenticator(c)
+	if err != nil || auth == nil {
+		return auth, err
+	}
+	c.App.Metadata[authenticatorKey] = auth
+	return auth, nil
+}
+
+// newAuthenticator returns the authenticator selected with --auth, or nil to
+// send the API key the way the gateway type expects it.
+func newAuthenticator(c *cli.Context) (client.Authenticator, error) {
+	switch strings.ToLower(c.String("auth")) {
+	case "":
+		return nil, nil
+	case "none":
+		return client.NoAuth{}, nil
+	case "bearer":
+		if c.String("api-key") == "" {
+			return nil, fmt.Errorf("bearer authentication requires --api-key")
+		}
+		return client.BearerAuth{Token: c.String("api-key")}, nil
+	case "basic":
+		if c.String("auth-username") == "" {
+			return nil, fmt.Errorf("basic authentication requires --auth-username")
+		}
+		return client.BasicAuth{Username: c.String("auth-username"), Password: c.String("auth-password")}, nil
+	case "header":
+		if c.String("auth-header") == "" {
+			return nil, fmt.Errorf("header authentication requires --auth-header")
+		}
+		return client.HeaderAuth{Name: c.String("auth-header"), Value: c.String("api-key")}, nil
+	case "oauth2":
+		if c.String("oauth2-token-url") == "" || c.String("oauth2-client-id") == "" {
+			return nil, fmt.Errorf("oauth2 authentication requires --oauth2-token-url and --oauth2-client-id")
+		}
+		tlsConfig, err := newTLSConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		return client.NewOAuth2ClientCredentials(
+			c.String("oauth2-token-url"),
+			c.String("oauth2-client-id"),
+			c.String("oauth2-client-secret"),
+			splitList(c.String("oauth2-scopes")),
+			tlsConfig,
+		), nil
+	case "sigv4":
+		creds, err := sigv4.CredentialsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		// AWS_REGION is only a fallback, a region set by the environment
+		// in the project file takes precedence over it.
+		region := c.String("sigv4-region")
+		if region == "" {
+			region = os.Getenv("AWS_REGION")
+		}
+		if region == "" {
+			return nil, fmt.Errorf("sigv4 authentication requires --sigv4-region or AWS_REGION")
+		}
+		return client.SigV4Auth{Signer: &sigv4.Signer{
+			Credentials: creds,
+			Region:      region,
+			Service:     c.String("sigv4-service"),
+		}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported authentication: %s", c.String("auth"))
+	}
+}
+
+// splitList splits a comma or space separated list.
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+}
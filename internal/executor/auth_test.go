@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func newTestContext(t *testing.T, flags []cli.Flag, args ...string) *cli.Context {
+	t.Helper()
+	app := cli.NewApp()
+	app.Metadata = make(map[string]interface{})
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range flags {
+		if err := f.Apply(set); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cli.NewContext(app, set, nil)
+}
+
+func TestAuthenticatorIsShared(t *testing.T) {
+	c := newTestContext(t, []cli.Flag{
+		&cli.StringFlag{Name: "auth"},
+		&cli.StringFlag{Name: "oauth2-token-url"},
+		&cli.StringFlag{Name: "oauth2-client-id"},
+		&cli.StringFlag{Name: "oauth2-client-secret"},
+		&cli.StringFlag{Name: "oauth2-scopes"},
+	}, "--auth", "oauth2", "--oauth2-token-url", "https://login.example.com/token", "--oauth2-client-id", "restmigrate")
+
+	first, err := authenticator(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := authenticator(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == nil || first != second {
+		t.Errorf("got %p and %p, want one shared authenticator", first, second)
+	}
+}
+
+func TestAuthenticatorDefault(t *testing.T) {
+	c := newTestContext(t, []cli.Flag{&cli.StringFlag{Name: "auth"}})
+	auth, err := authenticator(c)
+	if err != nil || auth != nil {
+		t.Errorf("got %v, %v, want no authenticator", auth, err)
+	}
+}
@@ -0,0 +1,114 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/krzko/restmigrate/internal/migration"
+	"github.com/krzko/restmigrate/internal/telemetry"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	checksumMismatchFail = "fail"
+	checksumMismatchWarn = "warn"
+)
+
+// checksumMismatches returns the applied migrations whose file no longer
+// matches the checksum recorded when they were applied. Migrations recorded
+// without a checksum are skipped.
+func checksumMismatches(state *migration.State, migrations []migration.Migration) ([]migration.Migration, error) {
+	recorded := make(map[int64]string, len(state.AppliedMigrations))
+	for _, m := range state.AppliedMigrations {
+		recorded[m.Timestamp] = m.Checksum
+	}
+
+	var mismatches []migration.Migration
+	for _, m := range migrations {
+		expected, ok := recorded[m.Timestamp]
+		if !ok {
+			continue
+		}
+		if expected == "" {
+			logger.Debug("No checksum recorded for applied migration", "name", m.Name)
+			continue
+		}
+
+		actual, err := m.Checksum()
+		if err != nil {
+			return nil, err
+		}
+		if actual != expected {
+			mismatches = append(mismatches, m)
+		}
+	}
+
+	return mismatches, nil
+}
+
+func verifyChecksums(state *migration.State, migrations []migration.Migration, mode string) error {
+	if mode != checksumMismatchFail && mode != checksumMismatchWarn {
+		return fmt.Errorf("invalid checksum mismatch mode %q, expected %s or %s", mode, checksumMismatchFail, checksumMismatchWarn)
+	}
+
+	mismatches, err := checksumMismatches(state, migrations)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range mismatches {
+		logger.Warn("Applied migration has been modified", "timestamp", m.Timestamp, "name", m.Name)
+	}
+
+	if len(mismatches) > 0 && mode == checksumMismatchFail {
+		return fmt.Errorf("%d applied migration(s) have been modified, run repair to accept the changes", len(mismatches))
+	}
+
+	return nil
+}
+
+// RepairChecksums records the current checksum of every applied migration,
+// accepting the edits made to them. It holds the state lock like any other
+// command that writes the state.
+func RepairChecksums(ctx context.Context, c *cli.Context) error {
+	ctx, span := telemetry.StartSpan(ctx, "RepairChecksums")
+	defer span.End()
+
+	logger.Debug("Starting RepairChecksums")
+
+	return editState(ctx, c, "repair", func(state *migration.State, migrations []migration.Migration) error {
+		files := make(map[int64]migration.Migration, len(migrations))
+		for _, m := range migrations {
+			files[m.Timestamp] = m
+		}
+
+		repaired := 0
+		for i, applied := range state.AppliedMigrations {
+			m, ok := files[applied.Timestamp]
+			if !ok {
+				logger.Warn("Skipping applied migration without a file", "timestamp", applied.Timestamp, "name", applied.Name)
+				continue
+			}
+
+			checksum, err := m.Checksum()
+			if err != nil {
+				return err
+			}
+			if checksum == applied.Checksum {
+				continue
+			}
+
+			logger.Info("Updating checksum", "name", applied.Name, "old", applied.Checksum, "new", checksum)
+			state.AppliedMigrations[i].Checksum = checksum
+			repaired++
+		}
+
+		if repaired == 0 {
+			logger.Info("All checksums are up to date")
+		} else {
+			logger.Info("Repaired checksums", "count", repaired)
+		}
+		return nil
+	})
+}
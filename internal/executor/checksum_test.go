@@ -0,0 +1,168 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/krzko/restmigrate/internal/migration"
+	"github.com/urfave/cli/v2"
+)
+
+func checksumMigration(timestamp int64, name, path string) migration.Migration {
+	return migration.Migration{
+		Timestamp: timestamp,
+		Name:      name,
+		Up:        migration.Actions{Steps: []migration.Step{{Method: "PUT", Path: path}}},
+		Down:      migration.Actions{Steps: []migration.Step{{Method: "DELETE", Path: path}}},
+	}
+}
+
+func TestChecksumMismatches(t *testing.T) {
+	files := []migration.Migration{
+		checksumMigration(100, "create_service", "/services/a"),
+		checksumMigration(200, "create_route", "/routes/a"),
+		checksumMigration(300, "add_plugin", "/plugins/a"),
+	}
+	sum := func(m migration.Migration) string {
+		s, err := m.Checksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	edited := checksumMigration(200, "create_route", "/routes/b")
+
+	tests := []struct {
+		name    string
+		applied []migration.AppliedMigration
+		want    []int64
+	}{
+		{
+			name: "unchanged",
+			applied: []migration.AppliedMigration{
+				{Timestamp: 100, Checksum: sum(files[0])},
+				{Timestamp: 200, Checksum: sum(files[1])},
+			},
+		},
+		{
+			name: "edited",
+			applied: []migration.AppliedMigration{
+				{Timestamp: 100, Checksum: sum(files[0])},
+				{Timestamp: 200, Checksum: sum(edited)},
+			},
+			want: []int64{200},
+		},
+		{
+			name:    "no recorded checksum",
+			applied: []migration.AppliedMigration{{Timestamp: 100}},
+		},
+		{
+			name:    "pending migrations are not compared",
+			applied: []migration.AppliedMigration{{Timestamp: 100, Checksum: sum(files[0])}},
+		},
+		{
+			name:    "applied without a file",
+			applied: []migration.AppliedMigration{{Timestamp: 400, Checksum: "abc"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mismatches, err := checksumMismatches(&migration.State{AppliedMigrations: tt.applied}, files)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []int64
+			for _, m := range mismatches {
+				got = append(got, m.Timestamp)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	file := checksumMigration(100, "create_service", "/services/a")
+	state := &migration.State{AppliedMigrations: []migration.AppliedMigration{{Timestamp: 100, Checksum: "stale"}}}
+	checksum, err := file.Checksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := &migration.State{AppliedMigrations: []migration.AppliedMigration{{Timestamp: 100, Checksum: checksum}}}
+
+	tests := []struct {
+		name    string
+		state   *migration.State
+		mode    string
+		wantErr string
+	}{
+		{name: "fail on mismatch", state: state, mode: checksumMismatchFail, wantErr: "1 applied migration(s) have been modified, run repair to accept the changes"},
+		{name: "warn on mismatch", state: state, mode: checksumMismatchWarn},
+		{name: "fail without mismatch", state: current, mode: checksumMismatchFail},
+		{name: "invalid mode", state: current, mode: "ignore", wantErr: `invalid checksum mismatch mode "ignore", expected fail or warn`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyChecksums(tt.state, []migration.Migration{file}, tt.mode)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRepairChecksumsTakesLock(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "20240701_110543_create_service.cue"), []byte(`
+migrations: [{
+	timestamp: 1719831943
+	name:      "create_service"
+	up: steps: [{method: "PUT", path: "/services/a"}]
+	down: steps: [{method: "DELETE", path: "/services/a"}]
+}]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := `{"applied_migrations": [{"timestamp": 1719831943, "name": "create_service", "checksum": "stale"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "restmigrate.state"), []byte(state), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestContext(t, []cli.Flag{&cli.StringFlag{Name: "path"}}, "--path", dir)
+
+	// Another run holds the lock.
+	backend, err := migration.NewStateBackend("", dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := migration.AcquireLock(context.Background(), backend, "up", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RepairChecksums(context.Background(), c); err == nil {
+		t.Fatal("repair succeeded while the state was locked")
+	}
+	if got := readState(t, dir).AppliedMigrations[0].Checksum; got != "stale" {
+		t.Errorf("checksum = %s, want the state untouched", got)
+	}
+
+	if err := lock.Release(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := RepairChecksums(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readState(t, dir).AppliedMigrations[0].Checksum; got == "stale" {
+		t.Error("checksum was not repaired")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "restmigrate.state.lock")); !os.IsNotExist(err) {
+		t.Errorf("lock was not released: %v", err)
+	}
+}
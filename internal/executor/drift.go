@@ -0,0 +1,164 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/krzko/restmigrate/internal/migration"
+	"github.com/krzko/restmigrate/internal/telemetry"
+	"github.com/krzko/restmigrate/pkg/rest"
+	client "github.com/krzko/restmigrate/pkg/rest"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli/v2"
+)
+
+// DetectDrift compares the live resources of the target API with the state
+// the applied migrations leave them in, and fails when any of them differ.
+func DetectDrift(ctx context.Context, c *cli.Context) error {
+	ctx, span := telemetry.StartSpan(ctx, "DetectDrift")
+	defer span.End()
+
+	logger.Debug("Starting DetectDrift")
+	opts, err := newRunOptions(c)
+	if err != nil {
+		return err
+	}
+
+	state, err := loadState(ctx, c)
+	if err != nil {
+		logger.Error("Failed to load state", "error", err)
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	migrations, err := loadMigrations(opts.path, opts.vars)
+	if err != nil {
+		logger.Error("Failed to load migrations", "error", err)
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	var applied []migration.Migration
+	for _, m := range migrations {
+		if containsMigration(state.AppliedMigrations, m.Timestamp) {
+			applied = append(applied, m)
+		}
+	}
+	for _, m := range state.AppliedMigrations {
+		if !containsTimestamp(migrations, m.Timestamp) {
+			logger.Warn("Applied migration file not found, its resources are not checked", "name", m.Name, "timestamp", m.Timestamp)
+		}
+	}
+
+	resources, warnings := migration.ExpectedResources(applied, state.Captures())
+	for _, warning := range warnings {
+		logger.Warn("Skipping step", "reason", warning)
+	}
+	if len(resources) == 0 {
+		logger.Info("No resources to check")
+		return nil
+	}
+
+	apiClient, err := newAPIClient(c, opts)
+	if err != nil {
+		logger.Error("Failed to create API client", "error", err)
+		return fmt.Errorf("failed to create API client: %w", err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Resource", "Field", "Expected", "Live", "Last Migration"})
+	table.SetBorder(false)
+	table.SetColumnSeparator(" ")
+	table.SetAutoWrapText(false)
+
+	var drifted int
+	for _, resource := range resources {
+		diffs, err := checkDrift(ctx, apiClient, c.String("type"), resource)
+		if err != nil {
+			logger.Error("Failed to check resource", "path", resource.Path, "error", err)
+			return fmt.Errorf("failed to check %s: %w", resource.Path, err)
+		}
+		if len(diffs) == 0 {
+			logger.Debug("Resource matches", "path", resource.Path)
+			continue
+		}
+
+		drifted++
+		for _, diff := range diffs {
+			live := formatValue(diff.Live)
+			if diff.Missing {
+				live = "<missing>"
+			}
+			table.Append([]string{
+				resource.Path,
+				diff.Field,
+				formatValue(diff.Expected),
+				live,
+				resource.Migration,
+			})
+		}
+	}
+
+	if drifted == 0 {
+		logger.Info("No drift detected", "resources", len(resources))
+		return nil
+	}
+
+	logger.Warn("Drift detected", "resources", len(resources), "drifted", drifted)
+	table.Render()
+	return fmt.Errorf("drift detected in %d of %d resource(s)", drifted, len(resources))
+}
+
+// checkDrift fetches the live resource and compares it with the expected one.
+// A resource that should exist but is gone, or the other way round, is
+// reported as a difference of the whole resource.
+func checkDrift(ctx context.Context, apiClient client.Client, gatewayType string, resource migration.Resource) ([]migration.Difference, error) {
+	resp, err := apiClient.SendRequest(ctx, rest.Request{
+		Method:       http.MethodGet,
+		Endpoint:     resource.Path,
+		IgnoreStatus: []int{http.StatusNotFound},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists := resp.StatusCode != http.StatusNotFound
+	switch {
+	case resource.Deleted && exists:
+		return []migration.Difference{{Field: "(resource)", Expected: "<deleted>", Live: "<exists>"}}, nil
+	case resource.Deleted:
+		return nil, nil
+	case !exists:
+		return []migration.Difference{{Field: "(resource)", Expected: "<exists>", Missing: true}}, nil
+	case resource.Body == nil:
+		return nil, nil
+	}
+
+	live, err := client.DecodeResource(gatewayType, resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return migration.Diff(resource.Body, live), nil
+}
+
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func containsTimestamp(migrations []migration.Migration, timestamp int64) bool {
+	for _, m := range migrations {
+		if m.Timestamp == timestamp {
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,15 @@ package executor
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/krzko/restmigrate/internal/cue"
@@ -23,47 +28,121 @@ func ExecuteUp(ctx context.Context, c *cli.Context) error {
 	defer span.End()
 
 	logger.Debug("Starting ExecuteUp")
-	path := c.String("path")
+	opts, err := newRunOptions(c)
+	if err != nil {
+		return err
+	}
+
+	backend, err := newStateBackend(c)
+	if err != nil {
+		logger.Error("Failed to create state backend", "error", err)
+		return fmt.Errorf("failed to create state backend: %w", err)
+	}
 
-	state, err := migration.LoadState(ctx, path, AppConfig.Version)
+	unlock, err := lockState(ctx, backend, "up", opts)
+	if err != nil {
+		logger.Error("Failed to lock state", "error", err)
+		return err
+	}
+	defer unlock()
+
+	state, err := migration.LoadState(ctx, backend, AppConfig.Version)
 	if err != nil {
 		logger.Error("Failed to load state", "error", err)
 		return fmt.Errorf("failed to load state: %w", err)
 	}
 
-	migrations, err := loadMigrations(path)
+	migrations, err := loadMigrations(opts.path, opts.vars)
 	if err != nil {
 		logger.Error("Failed to load migrations", "error", err)
 		return fmt.Errorf("failed to load migrations: %w", err)
 	}
 
-	apiClient, err := client.NewClient(c.String("type"), c.String("base-url"), c.String("api-key"))
+	err = verifyChecksums(state, migrations, opts.checksumMismatch)
+	if err != nil {
+		logger.Error("Failed to verify checksums", "error", err)
+		return err
+	}
+
+	apiClient, err := newAPIClient(c, opts)
 	if err != nil {
 		logger.Error("Failed to create API client", "error", err)
 		return fmt.Errorf("failed to create API client: %w", err)
 	}
 
+	pending, err := selectPending(state, migrations, c.String("to"), c.Int("steps"))
+	if err != nil {
+		logger.Error("Failed to select migrations", "error", err)
+		return err
+	}
+	if len(pending) == 0 {
+		logger.Info("No migrations to apply")
+		return nil
+	}
+
+	err = applyMigrations(ctx, state, apiClient, pending, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		logger.Info("Dry run complete, no requests were sent")
+		return nil
+	}
+
+	logger.Info("Applied migrations", "count", len(pending))
+	return nil
+}
+
+// applyMigrations applies migrations in order, recording each of them in the
+// state once its steps succeeded. A migration that fails part way is rolled
+// back unless --no-rollback is set, and stops the run.
+func applyMigrations(ctx context.Context, state *migration.State, apiClient client.Client, migrations []migration.Migration, opts runOptions) error {
+	captures := state.Captures()
 	for _, m := range migrations {
-		if !containsMigration(state.AppliedMigrations, m.Timestamp) {
-			logger.Info("Applying migration", "name", m.Name)
-			err := applyMigration(ctx, apiClient, m.Up)
+		if opts.dryRun {
+			printPlanHeader("up", m)
+		}
+		logger.Info("Applying migration", "name", m.Name)
+		snapshots := newSnapshotRecorder(m, opts)
+		runCtx, cancel := requestContext(ctx, opts)
+		applied, err := applyMigration(runCtx, apiClient, m.Up, captures, snapshots, opts)
+		cancel()
+		if err != nil {
+			logger.Error("Failed to apply migration", "name", m.Name, "error", err)
+			err = fmt.Errorf("failed to apply migration %s: %w", m.Name, err)
+			if opts.noRollback || opts.dryRun {
+				return err
+			}
+			if m.Down.Auto {
+				return errors.Join(err, rollbackSnapshots(ctx, apiClient, m, snapshots.taken(), captures, opts))
+			}
+			return errors.Join(err, rollbackSteps(ctx, apiClient, m, applied, captures, opts))
+		}
+		if !opts.dryRun {
+			checksum, err := m.Checksum()
 			if err != nil {
-				logger.Error("Failed to apply migration", "name", m.Name, "error", err)
-				return fmt.Errorf("failed to apply migration %s: %w", m.Name, err)
+				return err
 			}
-			state.AddMigration(m.Timestamp, m.Name)
-			err = state.SaveState(ctx, path)
+			state.AddMigration(m.Timestamp, m.Name, checksum)
+			state.SetCaptures(m.Timestamp, capturedBy(m.Up, captures))
+			state.SetSnapshots(m.Timestamp, snapshots.taken())
+			err = state.SaveState(ctx)
 			if err != nil {
 				logger.Error("Failed to save state", "error", err)
 				return fmt.Errorf("failed to save state: %w", err)
 			}
 			logger.Info("Successfully applied migration", "name", m.Name)
-		} else {
-			logger.Debug("Skipping already applied migration", "name", m.Name)
+		}
+		if err := afterMigration(ctx, apiClient, m); err != nil {
+			return err
+		}
+		if !opts.dryRun && !opts.skipVerify {
+			if err := verifyMigration(ctx, apiClient, m, captures); err != nil {
+				return err
+			}
 		}
 	}
-
-	logger.Info("All migrations have been applied")
 	return nil
 }
 
@@ -72,32 +151,59 @@ func ExecuteDown(ctx context.Context, c *cli.Context) error {
 	defer span.End()
 
 	logger.Debug("Starting ExecuteDown")
-	path := c.String("path")
+	opts, err := newRunOptions(c)
+	if err != nil {
+		return err
+	}
+
+	backend, err := newStateBackend(c)
+	if err != nil {
+		logger.Error("Failed to create state backend", "error", err)
+		return fmt.Errorf("failed to create state backend: %w", err)
+	}
 
-	state, err := migration.LoadState(ctx, path, AppConfig.Version)
+	unlock, err := lockState(ctx, backend, "down", opts)
+	if err != nil {
+		logger.Error("Failed to lock state", "error", err)
+		return err
+	}
+	defer unlock()
+
+	state, err := migration.LoadState(ctx, backend, AppConfig.Version)
 	if err != nil {
 		logger.Error("Failed to load state", "error", err)
 		return fmt.Errorf("failed to load state: %w", err)
 	}
 
-	if len(state.AppliedMigrations) == 0 {
+	count, err := revertCount(state, c.Bool("all"), c.String("to"), c.Int("steps"))
+	if err != nil {
+		logger.Error("Failed to select migrations", "error", err)
+		return err
+	}
+	if count == 0 {
 		logger.Info("No migrations to revert")
 		return nil
 	}
 
-	apiClient, err := client.NewClient(c.String("type"), c.String("base-url"), c.String("api-key"))
+	apiClient, err := newAPIClient(c, opts)
 	if err != nil {
 		logger.Error("Failed to create API client", "error", err)
 		return fmt.Errorf("failed to create API client: %w", err)
 	}
 
-	if c.Bool("all") {
-		logger.Info("Reverting all migrations")
-		return revertAllMigrations(ctx, state, apiClient, path)
+	logger.Info("Reverting migrations", "count", count)
+	err = revertMigrations(ctx, state, apiClient, count, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		logger.Info("Dry run complete, no requests were sent")
+		return nil
 	}
 
-	logger.Info("Reverting last migration")
-	return revertLastMigration(ctx, state, apiClient, path)
+	logger.Info("Reverted migrations", "count", count, "remaining", len(state.AppliedMigrations))
+	return nil
 }
 
 func ListMigrations(ctx context.Context, c *cli.Context) error {
@@ -105,9 +211,7 @@ func ListMigrations(ctx context.Context, c *cli.Context) error {
 	defer span.End()
 
 	logger.Debug("Starting ListMigrations")
-	path := c.String("path")
-
-	state, err := migration.LoadState(ctx, path, AppConfig.Version)
+	state, err := loadState(ctx, c)
 	if err != nil {
 		logger.Error("Failed to load state", "error", err)
 		return fmt.Errorf("failed to load state: %w", err)
@@ -138,67 +242,308 @@ func ListMigrations(ctx context.Context, c *cli.Context) error {
 	return nil
 }
 
-func revertAllMigrations(ctx context.Context, state *migration.State, apiClient client.Client, path string) error {
-	logger.Debug("Starting revertAllMigrations")
+// revertMigrations reverts the last count applied migrations, newest first,
+// removing each of them from the state once its down steps succeeded.
+func revertMigrations(ctx context.Context, state *migration.State, apiClient client.Client, count int, opts runOptions) error {
+	logger.Debug("Starting revertMigrations", "count", count)
 
-	for i := len(state.AppliedMigrations) - 1; i >= 0; i-- {
+	last := len(state.AppliedMigrations) - 1
+	for i := last; i > last-count && i >= 0; i-- {
 		appliedMigration := state.AppliedMigrations[i]
-		m, err := loadMigration(path, appliedMigration.Timestamp)
+		m, err := loadMigration(opts.path, opts.vars, appliedMigration.Timestamp)
 		if err != nil {
 			logger.Error("Failed to load migration", "timestamp", appliedMigration.Timestamp, "error", err)
 			return fmt.Errorf("failed to load migration: %w", err)
 		}
 
+		if opts.dryRun {
+			printPlanHeader("down", *m)
+		}
 		logger.Info("Reverting migration", "name", m.Name)
-		err = applyMigration(ctx, apiClient, m.Down)
+		down, err := downActions(state, *m, opts.gatewayType)
 		if err != nil {
 			logger.Error("Failed to revert migration", "name", m.Name, "error", err)
 			return fmt.Errorf("failed to revert migration %s: %w", m.Name, err)
 		}
-
-		state.RemoveLastMigration()
-		err = state.SaveState(ctx, path)
+		runCtx, cancel := requestContext(ctx, opts)
+		_, err = applyMigration(runCtx, apiClient, down, state.Captures(), nil, opts)
+		cancel()
 		if err != nil {
-			logger.Error("Failed to save state", "error", err)
-			return fmt.Errorf("failed to save state: %w", err)
+			logger.Error("Failed to revert migration", "name", m.Name, "error", err)
+			return fmt.Errorf("failed to revert migration %s: %w", m.Name, err)
+		}
+		if !opts.dryRun {
+			state.RemoveLastMigration()
+			err = state.SaveState(ctx)
+			if err != nil {
+				logger.Error("Failed to save state", "error", err)
+				return fmt.Errorf("failed to save state: %w", err)
+			}
+			logger.Info("Successfully reverted migration", "name", m.Name)
 		}
+		if err := afterMigration(ctx, apiClient, *m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		logger.Info("Successfully reverted migration", "name", m.Name)
+// afterMigration runs the post-apply hook of clients that need one, e.g. to
+// reload the gateway once the requests of a migration have been sent. The
+// migration is already recorded in the state when the hook fails, as its
+// requests were applied.
+func afterMigration(ctx context.Context, apiClient client.Client, m migration.Migration) error {
+	hook, ok := apiClient.(client.AfterMigrationHook)
+	if !ok {
+		return nil
 	}
 
-	logger.Info("All migrations have been reverted")
+	ctx, span := telemetry.StartSpan(ctx, "AfterMigration")
+	defer span.End()
+
+	logger.Debug("Running post-migration hook", "name", m.Name)
+	if err := hook.AfterMigration(ctx); err != nil {
+		logger.Error("Post-migration hook failed", "name", m.Name, "error", err)
+		return fmt.Errorf("post-migration hook failed for %s: %w", m.Name, err)
+	}
 	return nil
 }
 
-func revertLastMigration(ctx context.Context, state *migration.State, apiClient client.Client, path string) error {
-	logger.Debug("Starting revertLastMigration")
+// runOptions holds the settings shared by the commands that send requests.
+type runOptions struct {
+	path             string
+	gatewayType      string
+	dryRun           bool
+	checksumMismatch string
+	lockTimeout      time.Duration
+	lockTTL          time.Duration
+	noRollback       bool
+	skipVerify       bool
+	vars             map[string]string
+	deadline         time.Time
+}
+
+func newRunOptions(c *cli.Context) (runOptions, error) {
+	vars, err := migrationVars(c)
+	if err != nil {
+		return runOptions{}, err
+	}
+
+	var deadline time.Time
+	lockTTL := c.Duration("lock-ttl")
+	if timeout := c.Duration("timeout"); timeout > 0 {
+		deadline = time.Now().Add(timeout)
+
+		// The lock must outlive the run, including the rollback and state
+		// update that follow an expired timeout.
+		if lockTTL <= timeout {
+			if c.IsSet("lock-ttl") {
+				return runOptions{}, fmt.Errorf("--lock-ttl must be longer than --timeout")
+			}
+			lockTTL = timeout + migration.DefaultLockTTL
+		}
+	}
+
+	return runOptions{
+		path:             c.String("path"),
+		gatewayType:      c.String("type"),
+		dryRun:           c.Bool("dry-run"),
+		checksumMismatch: c.String("checksum-mismatch"),
+		lockTimeout:      c.Duration("lock-timeout"),
+		lockTTL:          lockTTL,
+		noRollback:       c.Bool("no-rollback"),
+		skipVerify:       c.Bool("skip-verify"),
+		vars:             vars,
+		deadline:         deadline,
+	}, nil
+}
+
+// requestContext bounds ctx by the overall --timeout of the run. Only the
+// requests of migrations are bounded, compensation and state updates still run
+// once the timeout expired.
+func requestContext(ctx context.Context, opts runOptions) (context.Context, context.CancelFunc) {
+	if opts.deadline.IsZero() {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, opts.deadline)
+}
+
+// lockState acquires the state lock for operation and returns a function that
+// releases it. Dry runs never write the state and are not locked.
+func lockState(ctx context.Context, backend migration.StateBackend, operation string, opts runOptions) (func(), error) {
+	if opts.dryRun {
+		return func() {}, nil
+	}
+
+	lock, err := migration.AcquireLock(ctx, backend, operation, opts.lockTimeout, opts.lockTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := lock.Release(ctx); err != nil {
+			logger.Error("Failed to release state lock", "id", lock.Info.ID, "error", err)
+		}
+	}, nil
+}
+
+// gatewayState selects the state backend stored on the target gateway.
+const gatewayState = "gateway"
 
-	lastMigration := state.AppliedMigrations[len(state.AppliedMigrations)-1]
-	m, err := loadMigration(path, lastMigration.Timestamp)
+func loadState(ctx context.Context, c *cli.Context) (*migration.State, error) {
+	backend, err := newStateBackend(c)
 	if err != nil {
-		logger.Error("Failed to load migration", "timestamp", lastMigration.Timestamp, "error", err)
-		return fmt.Errorf("failed to load migration: %w", err)
+		return nil, err
+	}
+	return migration.LoadState(ctx, backend, AppConfig.Version)
+}
+
+func newStateBackend(c *cli.Context) (migration.StateBackend, error) {
+	stateURL := c.String("state")
+	if stateURL != gatewayState {
+		tlsConfig, err := newTLSConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		return migration.NewStateBackend(stateURL, c.String("path"), tlsConfig)
 	}
 
-	logger.Info("Reverting migration", "name", m.Name)
-	err = applyMigration(ctx, apiClient, m.Down)
+	if c.String("base-url") == "" {
+		return nil, fmt.Errorf("the gateway state backend requires --base-url or an environment with base_url")
+	}
+	clientOpts, err := clientOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	// The state client never runs in dry run mode, the state must be read
+	// even when requests are only printed.
+	stateClient, err := client.NewClient(c.String("type"), c.String("base-url"), c.String("api-key"), clientOpts...)
 	if err != nil {
-		logger.Error("Failed to revert migration", "name", m.Name, "error", err)
-		return fmt.Errorf("failed to revert migration %s: %w", m.Name, err)
+		return nil, fmt.Errorf("failed to create state client: %w", err)
 	}
+	return migration.NewGatewayBackend(stateClient, c.String("type"))
+}
 
-	state.RemoveLastMigration()
-	err = state.SaveState(ctx, path)
+// clientOptions returns the options shared by every client created for the
+// target API, the one sending migrations and the one reading gateway state.
+func clientOptions(c *cli.Context) ([]client.Option, error) {
+	var opts []client.Option
+
+	auth, err := authenticator(c)
 	if err != nil {
-		logger.Error("Failed to save state", "error", err)
-		return fmt.Errorf("failed to save state: %w", err)
+		return nil, err
+	}
+	if auth != nil {
+		opts = append(opts, client.WithAuthenticator(auth))
 	}
 
-	logger.Info("Successfully reverted last migration", "name", m.Name)
-	return nil
+	retryStatus, err := parseStatusList(c.String("retry-status"))
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts,
+		client.WithRetryPolicy(client.RetryPolicy{
+			MaxAttempts:     c.Int("retry-max-attempts"),
+			InitialBackoff:  c.Duration("retry-initial-backoff"),
+			MaxBackoff:      c.Duration("retry-max-backoff"),
+			RetryableStatus: retryStatus,
+		}),
+		client.WithRequestTimeout(c.Duration("request-timeout")),
+	)
+
+	tlsConfig, err := newTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, client.WithTLSConfig(tlsConfig))
+	}
+
+	return opts, nil
+}
+
+// newTLSConfig returns the TLS configuration set with the --tls-* flags, or nil
+// when none is set. It is used for every connection of a run, the admin API,
+// the OAuth2 token URL and the remote state backends.
+func newTLSConfig(c *cli.Context) (*tls.Config, error) {
+	tlsOpts := client.TLSOptions{
+		CertFile:           c.String("tls-cert"),
+		KeyFile:            c.String("tls-key"),
+		CAFile:             c.String("tls-ca"),
+		ServerName:         c.String("tls-server-name"),
+		MinVersion:         c.String("tls-min-version"),
+		InsecureSkipVerify: c.Bool("insecure-skip-verify"),
+	}
+	if tlsOpts == (client.TLSOptions{}) {
+		return nil, nil
+	}
+	if tlsOpts.InsecureSkipVerify {
+		logger.Warn("TLS certificate verification is disabled")
+	}
+	return client.NewTLSConfig(tlsOpts)
+}
+
+func newAPIClient(c *cli.Context, opts runOptions) (client.Client, error) {
+	if c.String("base-url") == "" {
+		return nil, fmt.Errorf("base URL is required, set --base-url or select an environment with --env")
+	}
+
+	clientOpts, err := clientOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	if opts.dryRun {
+		clientOpts = append(clientOpts, client.WithDryRun(os.Stdout), client.WithDryRunVars(opts.vars))
+	}
+	if reload := c.String("reload"); reload != "" {
+		req, err := parseReload(reload)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, client.WithReload(req))
+	}
+	if endpoint := c.String("health-path"); endpoint != "" {
+		clientOpts = append(clientOpts, client.WithHealthCheck(client.HealthCheck{
+			Endpoint: endpoint,
+			Interval: c.Duration("health-interval"),
+			Timeout:  c.Duration("health-timeout"),
+		}))
+	}
+	return client.NewClient(c.String("type"), c.String("base-url"), c.String("api-key"), clientOpts...)
+}
+
+// parseStatusList parses a comma or space separated list of HTTP status codes.
+func parseStatusList(value string) ([]int, error) {
+	var statuses []int
+	for _, item := range splitList(value) {
+		status, err := strconv.Atoi(item)
+		if err != nil || status < 100 || status > 599 {
+			return nil, fmt.Errorf("invalid HTTP status %q", item)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// parseReload parses a reload request given as "METHOD /path", or as a bare
+// path which is sent with POST.
+func parseReload(reload string) (client.Request, error) {
+	method, endpoint, ok := strings.Cut(strings.TrimSpace(reload), " ")
+	if !ok {
+		method, endpoint = http.MethodPost, method
+	}
+	endpoint = strings.TrimSpace(endpoint)
+	if !strings.HasPrefix(endpoint, "/") {
+		return client.Request{}, fmt.Errorf("invalid reload request %q, expected METHOD /path", reload)
+	}
+	return client.Request{Method: strings.ToUpper(method), Endpoint: endpoint}, nil
 }
 
-func loadMigrations(path string) ([]migration.Migration, error) {
+func printPlanHeader(direction string, m migration.Migration) {
+	fmt.Fprintf(os.Stdout, "# %s %d %s\n\n", direction, m.Timestamp, m.Name)
+}
+
+func loadMigrations(path string, vars map[string]string) ([]migration.Migration, error) {
 	logger.Debug("Loading migrations", "path", path)
 
 	files, err := filepath.Glob(filepath.Join(path, "*.cue"))
@@ -209,7 +554,7 @@ func loadMigrations(path string) ([]migration.Migration, error) {
 	var allMigrations []migration.Migration
 	for _, file := range files {
 		logger.Debug("Parsing migration file", "file", file)
-		migrations, err := cue.ParseMigration(file)
+		migrations, err := cue.ParseMigration(file, vars)
 		if err != nil {
 			logger.Error("Failed to parse migration file", "file", file, "error", err)
 			return nil, fmt.Errorf("failed to parse migration %s: %w", file, err)
@@ -225,10 +570,10 @@ func loadMigrations(path string) ([]migration.Migration, error) {
 	return allMigrations, nil
 }
 
-func loadMigration(path string, timestamp int64) (*migration.Migration, error) {
+func loadMigration(path string, vars map[string]string, timestamp int64) (*migration.Migration, error) {
 	logger.Debug("Loading migration", "timestamp", timestamp)
 
-	migrations, err := loadMigrations(path)
+	migrations, err := loadMigrations(path, vars)
 	if err != nil {
 		return nil, err
 	}
@@ -242,41 +587,87 @@ func loadMigration(path string, timestamp int64) (*migration.Migration, error) {
 	return nil, fmt.Errorf("migration not found for timestamp %d", timestamp)
 }
 
-func applyMigration(ctx context.Context, client client.Client, actions map[string]interface{}) error {
-	logger.Debug("Applying migration actions")
+// applyMigration sends the steps of actions in order and returns how many of
+// them succeeded. References to captured values are resolved from captures,
+// which is updated with the values captured by each step. When snapshots is
+// set, the resource of each step is recorded before it is changed.
+func applyMigration(ctx context.Context, client client.Client, actions migration.Actions, captures map[string]interface{}, snapshots *snapshotRecorder, opts runOptions) (int, error) {
+	logger.Debug("Applying migration actions", "steps", len(actions.Steps))
 
-	for endpoint, action := range actions {
-		actionMap, ok := action.(map[string]interface{})
-		if !ok {
-			logger.Error("Invalid action format", "endpoint", endpoint)
-			return fmt.Errorf("invalid action format for endpoint %s", endpoint)
+	for i, step := range actions.Steps {
+		step, err := step.Resolve(captures, opts.dryRun)
+		if err != nil {
+			logger.Error("Failed to resolve step", "step", i, "endpoint", step.Path, "error", err)
+			return i, fmt.Errorf("failed to resolve step %d (%s %s): %w", i, step.Method, step.Path, err)
 		}
 
-		method, ok := actionMap["method"].(string)
-		if !ok {
-			logger.Error("Missing or invalid method", "endpoint", endpoint)
-			return fmt.Errorf("missing or invalid method for endpoint %s", endpoint)
+		if err := snapshots.record(ctx, client, step); err != nil {
+			logger.Error("Failed to take snapshot", "step", i, "endpoint", step.Path, "error", err)
+			return i, err
 		}
 
-		var body interface{}
-		if bodyData, exists := actionMap["body"]; exists {
-			body = bodyData
-		}
+		logger.Debug("Applying step", "index", i, "method", step.Method, "path", step.Path)
 
-		err := client.SendRequest(ctx, method, endpoint, body)
+		resp, err := client.SendRequest(ctx, rest.Request{
+			Method:       step.Method,
+			Endpoint:     step.Path,
+			Body:         step.Body,
+			Headers:      step.Headers,
+			Expect:       step.Expect,
+			IgnoreStatus: step.IgnoreStatus,
+		})
 		if err != nil {
 			if errorResp, ok := err.(*rest.ErrorResponse); ok {
 				logger.Error("Failed to apply action",
-					"endpoint", endpoint,
+					"step", i,
+					"endpoint", step.Path,
 					"status", errorResp.StatusCode,
 					"response", errorResp.Body)
 			} else {
-				logger.Error("Failed to apply action", "endpoint", endpoint, "error", err)
+				logger.Error("Failed to apply action", "step", i, "endpoint", step.Path, "error", err)
 			}
-			return fmt.Errorf("failed to apply action for endpoint %s: %w", endpoint, err)
+			return i, fmt.Errorf("failed to apply step %d (%s %s): %w", i, step.Method, step.Path, err)
+		}
+
+		if opts.dryRun {
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			// An accepted error status, e.g. 409 for a resource that already
+			// exists, carries an error body rather than the resource.
+			logger.Info("Step returned an accepted status", "step", i, "endpoint", step.Path, "status", resp.StatusCode)
+			if len(step.Capture) > 0 {
+				logger.Warn("Skipping captures of step without a 2xx status", "step", i, "captures", len(step.Capture))
+			}
+			continue
+		}
+		for name, path := range step.Capture {
+			value, err := migration.ExtractCapture(resp.Body, path)
+			if err != nil {
+				logger.Error("Failed to capture value", "step", i, "name", name, "path", path, "error", err)
+				return i + 1, fmt.Errorf("failed to capture %s from step %d (%s %s): %w", name, i, step.Method, step.Path, err)
+			}
+			logger.Debug("Captured value", "name", name, "path", path, "value", value)
+			captures[name] = value
 		}
 	}
-	return nil
+	return len(actions.Steps), nil
+}
+
+// capturedBy returns the captured values named by the steps of actions.
+func capturedBy(actions migration.Actions, captures map[string]interface{}) map[string]interface{} {
+	names := actions.CaptureNames()
+	if len(names) == 0 {
+		return nil
+	}
+
+	values := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		if value, ok := captures[name]; ok {
+			values[name] = value
+		}
+	}
+	return values
 }
 
 func containsMigration(appliedMigrations []migration.AppliedMigration, timestamp int64) bool {
@@ -287,3 +678,34 @@ func containsMigration(appliedMigrations []migration.AppliedMigration, timestamp
 	}
 	return false
 }
+
+func ForceUnlock(ctx context.Context, c *cli.Context) error {
+	ctx, span := telemetry.StartSpan(ctx, "ForceUnlock")
+	defer span.End()
+
+	logger.Debug("Starting ForceUnlock")
+
+	backend, err := newStateBackend(c)
+	if err != nil {
+		logger.Error("Failed to create state backend", "error", err)
+		return fmt.Errorf("failed to create state backend: %w", err)
+	}
+
+	holder, err := migration.ForceUnlock(ctx, backend)
+	if errors.Is(err, migration.ErrLockNotFound) {
+		logger.Info("State is not locked")
+		return nil
+	} else if err != nil {
+		logger.Error("Failed to remove state lock", "error", err)
+		return fmt.Errorf("failed to remove state lock: %w", err)
+	}
+
+	logger.Info("Removed state lock",
+		"id", holder.ID,
+		"operation", holder.Operation,
+		"user", holder.User,
+		"host", holder.Host,
+		"pid", holder.PID,
+		"created", holder.Created.Format(time.RFC3339))
+	return nil
+}
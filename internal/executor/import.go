@@ -0,0 +1,128 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/krzko/restmigrate/internal/cue"
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/krzko/restmigrate/internal/migration"
+	"github.com/krzko/restmigrate/internal/telemetry"
+	client "github.com/krzko/restmigrate/pkg/rest"
+	"github.com/urfave/cli/v2"
+)
+
+// ImportResources generates a baseline migration from the configuration of a
+// live gateway and records it as applied, so existing installs can be adopted
+// without sending any changes.
+func ImportResources(ctx context.Context, c *cli.Context) error {
+	ctx, span := telemetry.StartSpan(ctx, "ImportResources")
+	defer span.End()
+
+	logger.Debug("Starting ImportResources")
+	opts, err := newRunOptions(c)
+	if err != nil {
+		return err
+	}
+
+	apiClient, err := newAPIClient(c, opts)
+	if err != nil {
+		logger.Error("Failed to create API client", "error", err)
+		return fmt.Errorf("failed to create API client: %w", err)
+	}
+	importer, ok := apiClient.(client.Importer)
+	if !ok {
+		return fmt.Errorf("gateway type %s does not support import", c.String("type"))
+	}
+
+	backend, err := newStateBackend(c)
+	if err != nil {
+		logger.Error("Failed to create state backend", "error", err)
+		return fmt.Errorf("failed to create state backend: %w", err)
+	}
+
+	unlock, err := lockState(ctx, backend, "import", opts)
+	if err != nil {
+		logger.Error("Failed to lock state", "error", err)
+		return err
+	}
+	defer unlock()
+
+	state, err := migration.LoadState(ctx, backend, AppConfig.Version)
+	if err != nil {
+		logger.Error("Failed to load state", "error", err)
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	if len(state.AppliedMigrations) > 0 {
+		logger.Warn("State already has applied migrations, their resources are imported again", "applied", len(state.AppliedMigrations))
+	}
+
+	resources, err := importer.ImportResources(ctx)
+	if err != nil {
+		logger.Error("Failed to import resources", "error", err)
+		return fmt.Errorf("failed to import resources: %w", err)
+	}
+	if len(resources) == 0 {
+		logger.Info("No resources found on the gateway")
+		return nil
+	}
+
+	now := time.Now()
+	m := importedMigration(now.Unix(), c.String("name"), resources)
+	content, err := cue.FormatMigration(m)
+	if err != nil {
+		logger.Error("Failed to format migration", "error", err)
+		return fmt.Errorf("failed to format migration: %w", err)
+	}
+
+	filePath := filepath.Join(opts.path, fmt.Sprintf("%s_%s.cue", now.Format("20060102_150405"), m.Name))
+	err = os.WriteFile(filePath, content, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create migration file: %w", err)
+	}
+	logger.Info("Created migration", "file", filePath, "resources", len(resources))
+
+	// The checksum is taken from the file as it is parsed by up and status.
+	written, err := loadMigration(opts.path, opts.vars, m.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to load imported migration: %w", err)
+	}
+	checksum, err := written.Checksum()
+	if err != nil {
+		return err
+	}
+
+	state.AddMigration(written.Timestamp, written.Name, checksum)
+	err = state.SaveState(ctx)
+	if err != nil {
+		logger.Error("Failed to save state", "error", err)
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	logger.Info("Recorded imported migration as applied", "name", written.Name, "timestamp", written.Timestamp)
+	return nil
+}
+
+// importedMigration creates each resource with PUT at its endpoint, and
+// deletes them in reverse order.
+func importedMigration(timestamp int64, name string, resources []client.ImportedResource) migration.Migration {
+	m := migration.Migration{Timestamp: timestamp, Name: name}
+	for _, r := range resources {
+		m.Up.Steps = append(m.Up.Steps, migration.Step{
+			Method: http.MethodPut,
+			Path:   r.Endpoint,
+			Body:   r.Body,
+		})
+	}
+	for i := len(resources) - 1; i >= 0; i-- {
+		m.Down.Steps = append(m.Down.Steps, migration.Step{
+			Method: http.MethodDelete,
+			Path:   resources[i].Endpoint,
+		})
+	}
+	return m
+}
@@ -0,0 +1,176 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/krzko/restmigrate/internal/migration"
+	"github.com/krzko/restmigrate/internal/telemetry"
+	"github.com/urfave/cli/v2"
+)
+
+// MarkApplied records a migration as applied without sending its requests,
+// e.g. after the change was made by hand.
+func MarkApplied(ctx context.Context, c *cli.Context) error {
+	ctx, span := telemetry.StartSpan(ctx, "MarkApplied")
+	defer span.End()
+
+	logger.Debug("Starting MarkApplied")
+	if c.NArg() == 0 {
+		return fmt.Errorf("migration timestamp or name is required")
+	}
+	target := c.Args().First()
+
+	return editState(ctx, c, "mark-applied", func(state *migration.State, migrations []migration.Migration) error {
+		i, err := findTarget(target, len(migrations), func(i int) (int64, string) {
+			return migrations[i].Timestamp, migrations[i].Name
+		})
+		if err != nil {
+			return err
+		}
+
+		m := migrations[i]
+		if containsMigration(state.AppliedMigrations, m.Timestamp) {
+			return fmt.Errorf("migration %s is already applied", m.Name)
+		}
+		return markApplied(state, m, "mark-applied", migration.NewMark())
+	})
+}
+
+// MarkReverted removes a migration from the state without sending its down
+// requests, e.g. after the change was undone by hand. The migration does not
+// have to be the last one applied, nor to have a migration file.
+func MarkReverted(ctx context.Context, c *cli.Context) error {
+	ctx, span := telemetry.StartSpan(ctx, "MarkReverted")
+	defer span.End()
+
+	logger.Debug("Starting MarkReverted")
+	if c.NArg() == 0 {
+		return fmt.Errorf("migration timestamp or name is required")
+	}
+	target := c.Args().First()
+
+	return editState(ctx, c, "mark-reverted", func(state *migration.State, migrations []migration.Migration) error {
+		i, err := findTarget(target, len(state.AppliedMigrations), func(i int) (int64, string) {
+			return state.AppliedMigrations[i].Timestamp, state.AppliedMigrations[i].Name
+		})
+		if err != nil {
+			return fmt.Errorf("%w among the applied migrations", err)
+		}
+
+		m := state.AppliedMigrations[i]
+		state.RemoveMigration(m.Timestamp)
+
+		mark := migration.NewMark()
+		state.AddAudit("mark-reverted", m.Timestamp, m.Name, mark)
+		logger.Info("Marked migration as reverted",
+			"timestamp", m.Timestamp,
+			"name", m.Name,
+			"user", mark.User,
+			"host", mark.Host,
+			"at", mark.At.Format(time.RFC3339))
+		if len(m.Captures) > 0 || len(m.Snapshots) > 0 {
+			logger.Warn("Dropped the captures and snapshots of the migration", "name", m.Name)
+		}
+		return nil
+	})
+}
+
+// Baseline records every pending migration up to and including the one given
+// with --at as applied, without sending their requests. It adopts a gateway
+// whose configuration already matches those migrations.
+func Baseline(ctx context.Context, c *cli.Context) error {
+	ctx, span := telemetry.StartSpan(ctx, "Baseline")
+	defer span.End()
+
+	logger.Debug("Starting Baseline")
+	target := c.String("at")
+
+	return editState(ctx, c, "baseline", func(state *migration.State, migrations []migration.Migration) error {
+		pending, err := selectPending(state, migrations, target, 0)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			logger.Info("No pending migrations up to the baseline", "at", target)
+			return nil
+		}
+
+		mark := migration.NewMark()
+		for _, m := range pending {
+			if err := markApplied(state, m, "baseline", mark); err != nil {
+				return err
+			}
+		}
+		logger.Info("Baselined migrations", "at", target, "count", len(pending))
+		return nil
+	})
+}
+
+// editState loads the state and migrations under the state lock, applies
+// edit and saves the state.
+func editState(ctx context.Context, c *cli.Context, operation string, edit func(*migration.State, []migration.Migration) error) error {
+	opts, err := newRunOptions(c)
+	if err != nil {
+		return err
+	}
+
+	backend, err := newStateBackend(c)
+	if err != nil {
+		logger.Error("Failed to create state backend", "error", err)
+		return fmt.Errorf("failed to create state backend: %w", err)
+	}
+
+	unlock, err := lockState(ctx, backend, operation, opts)
+	if err != nil {
+		logger.Error("Failed to lock state", "error", err)
+		return err
+	}
+	defer unlock()
+
+	state, err := migration.LoadState(ctx, backend, AppConfig.Version)
+	if err != nil {
+		logger.Error("Failed to load state", "error", err)
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	migrations, err := loadMigrations(opts.path, opts.vars)
+	if err != nil {
+		logger.Error("Failed to load migrations", "error", err)
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	if err := edit(state, migrations); err != nil {
+		logger.Error("Failed to update state", "operation", operation, "error", err)
+		return err
+	}
+
+	err = state.SaveState(ctx)
+	if err != nil {
+		logger.Error("Failed to save state", "error", err)
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
+
+// markApplied records m as applied with its current checksum, and operation
+// in the audit of the state.
+func markApplied(state *migration.State, m migration.Migration, operation string, mark migration.Mark) error {
+	checksum, err := m.Checksum()
+	if err != nil {
+		return err
+	}
+	state.AddMigration(m.Timestamp, m.Name, checksum)
+	state.SetMark(m.Timestamp, mark)
+	state.AddAudit(operation, m.Timestamp, m.Name, mark)
+
+	logger.Info("Marked migration as applied",
+		"timestamp", m.Timestamp,
+		"name", m.Name,
+		"user", mark.User,
+		"host", mark.Host,
+		"at", mark.At.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/krzko/restmigrate/internal/migration"
+	"github.com/urfave/cli/v2"
+)
+
+func readState(t *testing.T, dir string) migration.State {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "restmigrate.state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state migration.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestMarkRevertedIsAudited(t *testing.T) {
+	dir := t.TempDir()
+	state := `{"applied_migrations": [
+		{"timestamp": 100, "name": "create_service", "checksum": "a"},
+		{"timestamp": 200, "name": "create_route", "checksum": "b"}
+	]}`
+	if err := os.WriteFile(filepath.Join(dir, "restmigrate.state"), []byte(state), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestContext(t, []cli.Flag{&cli.StringFlag{Name: "path"}}, "--path", dir, "create_service")
+	if err := MarkReverted(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	saved := readState(t, dir)
+	if len(saved.AppliedMigrations) != 1 || saved.AppliedMigrations[0].Name != "create_route" {
+		t.Errorf("applied migrations = %+v", saved.AppliedMigrations)
+	}
+	if len(saved.Audit) != 1 {
+		t.Fatalf("audit = %+v, want one entry", saved.Audit)
+	}
+	entry := saved.Audit[0]
+	if entry.Operation != "mark-reverted" || entry.Timestamp != 100 || entry.Name != "create_service" {
+		t.Errorf("audit entry = %+v", entry)
+	}
+	if entry.At.IsZero() {
+		t.Errorf("audit entry has no time: %+v", entry)
+	}
+}
+
+func TestMarkRequiresTarget(t *testing.T) {
+	for name, mark := range map[string]func(context.Context, *cli.Context) error{"mark-applied": MarkApplied, "mark-reverted": MarkReverted} {
+		c := newTestContext(t, nil)
+		if err := mark(context.Background(), c); err == nil || err.Error() != "migration timestamp or name is required" {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/krzko/restmigrate/internal/migration"
+	"github.com/krzko/restmigrate/internal/telemetry"
+	"github.com/urfave/cli/v2"
+)
+
+// ExecuteRedo reverts the last applied migrations and applies them again from
+// their current files, under a single state lock. Edits to the redone
+// migrations are expected and do not fail the checksum verification.
+func ExecuteRedo(ctx context.Context, c *cli.Context) error {
+	ctx, span := telemetry.StartSpan(ctx, "ExecuteRedo")
+	defer span.End()
+
+	logger.Debug("Starting ExecuteRedo")
+	opts, err := newRunOptions(c)
+	if err != nil {
+		return err
+	}
+
+	backend, err := newStateBackend(c)
+	if err != nil {
+		logger.Error("Failed to create state backend", "error", err)
+		return fmt.Errorf("failed to create state backend: %w", err)
+	}
+
+	unlock, err := lockState(ctx, backend, "redo", opts)
+	if err != nil {
+		logger.Error("Failed to lock state", "error", err)
+		return err
+	}
+	defer unlock()
+
+	state, err := migration.LoadState(ctx, backend, AppConfig.Version)
+	if err != nil {
+		logger.Error("Failed to load state", "error", err)
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	count, err := revertCount(state, false, "", c.Int("steps"))
+	if err != nil {
+		logger.Error("Failed to select migrations", "error", err)
+		return err
+	}
+	if count == 0 {
+		logger.Info("No migrations to redo")
+		return nil
+	}
+
+	migrations, err := loadMigrations(opts.path, opts.vars)
+	if err != nil {
+		logger.Error("Failed to load migrations", "error", err)
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	redone := state.AppliedMigrations[len(state.AppliedMigrations)-count:]
+	var redo, others []migration.Migration
+	for _, m := range migrations {
+		if containsMigration(redone, m.Timestamp) {
+			redo = append(redo, m)
+		} else {
+			others = append(others, m)
+		}
+	}
+	if len(redo) != count {
+		return fmt.Errorf("cannot redo %d migration(s), only %d of them have a migration file", count, len(redo))
+	}
+
+	err = verifyChecksums(state, others, opts.checksumMismatch)
+	if err != nil {
+		logger.Error("Failed to verify checksums", "error", err)
+		return err
+	}
+
+	apiClient, err := newAPIClient(c, opts)
+	if err != nil {
+		logger.Error("Failed to create API client", "error", err)
+		return fmt.Errorf("failed to create API client: %w", err)
+	}
+
+	logger.Info("Redoing migrations", "count", count)
+	err = revertMigrations(ctx, state, apiClient, count, opts)
+	if err != nil {
+		return err
+	}
+	err = applyMigrations(ctx, state, apiClient, redo, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		logger.Info("Dry run complete, no requests were sent")
+		return nil
+	}
+
+	logger.Info("Redone migrations", "count", count)
+	return nil
+}
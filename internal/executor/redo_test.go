@@ -0,0 +1,202 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krzko/restmigrate/internal/migration"
+	"github.com/urfave/cli/v2"
+)
+
+// redoProject writes a migration file creating /services/<name> for each of
+// names, timestamped 100, 200, ..., and a state applying all of them with
+// their current checksums.
+func redoProject(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for i, name := range names {
+		content := fmt.Sprintf(`
+migrations: [{
+	timestamp: %d
+	name:      "create_%s"
+	up: steps: [{method: "PUT", path: "/services/%s", body: {name: "%s"}}]
+	down: steps: [{method: "DELETE", path: "/services/%s"}]
+}]
+`, (i+1)*100, name, name, name, name)
+		file := fmt.Sprintf("20240701_1100%02d_create_%s.cue", i, name)
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrations, err := loadMigrations(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state migration.State
+	for _, m := range migrations {
+		checksum, err := m.Checksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.AddMigration(m.Timestamp, m.Name, checksum)
+	}
+	writeState(t, dir, state)
+	return dir
+}
+
+func writeState(t *testing.T, dir string, state migration.State) {
+	t.Helper()
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "restmigrate.state"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newRedoContext(t *testing.T, dir, baseURL string, args ...string) *cli.Context {
+	t.Helper()
+	flags := []cli.Flag{
+		&cli.StringFlag{Name: "path"},
+		&cli.StringFlag{Name: "base-url"},
+		&cli.StringFlag{Name: "type", Value: "generic"},
+		&cli.StringFlag{Name: "checksum-mismatch", Value: checksumMismatchFail},
+		&cli.IntFlag{Name: "steps"},
+	}
+	return newTestContext(t, flags, append([]string{"--path", dir, "--base-url", baseURL}, args...)...)
+}
+
+func TestExecuteRedo(t *testing.T) {
+	tests := []struct {
+		steps string
+		want  []string
+	}{
+		{steps: "1", want: []string{"DELETE /services/c", "PUT /services/c"}},
+		{steps: "2", want: []string{"DELETE /services/c", "DELETE /services/b", "PUT /services/b", "PUT /services/c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.steps, func(t *testing.T) {
+			dir := redoProject(t, "a", "b", "c")
+			api, baseURL := startAPIServer(t)
+			c := newRedoContext(t, dir, baseURL, "--steps", tt.steps)
+
+			if err := ExecuteRedo(context.Background(), c); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := api.sent(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got requests %v, want %v", got, tt.want)
+			}
+
+			var applied []int64
+			for _, m := range readState(t, dir).AppliedMigrations {
+				applied = append(applied, m.Timestamp)
+			}
+			if want := []int64{100, 200, 300}; !reflect.DeepEqual(applied, want) {
+				t.Errorf("got applied %v, want %v", applied, want)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "restmigrate.state.lock")); !os.IsNotExist(err) {
+				t.Errorf("lock was not released: %v", err)
+			}
+		})
+	}
+}
+
+func TestExecuteRedoTakesLock(t *testing.T) {
+	dir := redoProject(t, "a", "b")
+	api, baseURL := startAPIServer(t)
+	c := newRedoContext(t, dir, baseURL)
+
+	// Another run holds the lock.
+	backend, err := migration.NewStateBackend("", dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := migration.AcquireLock(context.Background(), backend, "up", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release(context.Background())
+
+	err = ExecuteRedo(context.Background(), c)
+	if err == nil || !strings.Contains(err.Error(), "state is locked") {
+		t.Fatalf("got error %v, want the lock to be held", err)
+	}
+	if sent := api.sent(); len(sent) > 0 {
+		t.Errorf("got requests %v, want none", sent)
+	}
+}
+
+func TestExecuteRedoChecksums(t *testing.T) {
+	tests := []struct {
+		name     string
+		modified int64
+		wantErr  string
+	}{
+		{name: "redone migration modified", modified: 300},
+		{name: "other migration modified", modified: 100, wantErr: "1 applied migration(s) have been modified"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := redoProject(t, "a", "b", "c")
+			state := readState(t, dir)
+			for i := range state.AppliedMigrations {
+				if state.AppliedMigrations[i].Timestamp == tt.modified {
+					state.AppliedMigrations[i].Checksum = "stale"
+				}
+			}
+			writeState(t, dir, state)
+			api, baseURL := startAPIServer(t)
+			c := newRedoContext(t, dir, baseURL)
+
+			err := ExecuteRedo(context.Background(), c)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if sent := api.sent(); len(sent) > 0 {
+					t.Errorf("got requests %v, want none", sent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, m := range readState(t, dir).AppliedMigrations {
+				if m.Checksum == "stale" {
+					t.Errorf("checksum of %s was not updated", m.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteRedoMissingFile(t *testing.T) {
+	dir := redoProject(t, "a", "b")
+	state := readState(t, dir)
+	state.AddMigration(300, "create_c", "c")
+	writeState(t, dir, state)
+	api, baseURL := startAPIServer(t)
+	c := newRedoContext(t, dir, baseURL, "--steps", "2")
+
+	err := ExecuteRedo(context.Background(), c)
+	if err == nil || !strings.Contains(err.Error(), "cannot redo 2 migration(s), only 1 of them have a migration file") {
+		t.Fatalf("got error %v, want a missing file error", err)
+	}
+	if sent := api.sent(); len(sent) > 0 {
+		t.Errorf("got requests %v, want none", sent)
+	}
+	if got := len(readState(t, dir).AppliedMigrations); got != 3 {
+		t.Errorf("got %d applied migrations, want 3", got)
+	}
+}
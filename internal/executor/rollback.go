@@ -0,0 +1,69 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/krzko/restmigrate/internal/migration"
+	"github.com/krzko/restmigrate/internal/telemetry"
+	client "github.com/krzko/restmigrate/pkg/rest"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// rollbackSteps compensates the first applied steps of a partially applied
+// migration by sending the matching down steps in reverse order. Down steps are
+// matched to up steps by position, the last down step undoing the first up
+// step, so both blocks must have the same number of steps.
+func rollbackSteps(ctx context.Context, apiClient client.Client, m migration.Migration, applied int, captures map[string]interface{}, opts runOptions) error {
+	ctx, span := telemetry.StartSpan(ctx, "RollbackMigration")
+	defer span.End()
+
+	if applied == 0 {
+		logger.Info("No steps to roll back", "name", m.Name)
+		return nil
+	}
+
+	up, down := len(m.Up.Steps), len(m.Down.Steps)
+	if up != down {
+		err := fmt.Errorf("cannot roll back %d applied step(s) of %s: up has %d steps but down has %d, the gateway is partially migrated",
+			applied, m.Name, up, down)
+		logger.Error("Automatic rollback not possible", "name", m.Name, "applied", applied, "error", err)
+		telemetry.SetSpanStatus(span, err)
+		return err
+	}
+
+	logger.Warn("Rolling back applied steps", "name", m.Name, "steps", applied)
+
+	var failed []int
+	compensated := 0
+	for i := applied - 1; i >= 0; i-- {
+		step := m.Down.Steps[down-1-i]
+		logger.Info("Compensating step",
+			"step", i,
+			"up", fmt.Sprintf("%s %s", m.Up.Steps[i].Method, m.Up.Steps[i].Path),
+			"down", fmt.Sprintf("%s %s", step.Method, step.Path))
+
+		_, err := applyMigration(ctx, apiClient, migration.Actions{Steps: []migration.Step{step}}, captures, nil, opts)
+		if err != nil {
+			logger.Error("Failed to compensate step", "step", i, "error", err)
+			failed = append(failed, i)
+			continue
+		}
+		compensated++
+	}
+
+	span.SetAttributes(
+		attribute.Int("restmigrate.rollback.compensated", compensated),
+		attribute.Int("restmigrate.rollback.failed", len(failed)),
+	)
+
+	if len(failed) > 0 {
+		err := fmt.Errorf("rollback of %s incomplete, compensated %d of %d step(s), failed steps: %v", m.Name, compensated, applied, failed)
+		telemetry.SetSpanStatus(span, err)
+		return err
+	}
+
+	logger.Info("Rolled back migration", "name", m.Name, "compensated", compensated)
+	return nil
+}
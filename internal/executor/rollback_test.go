@@ -0,0 +1,207 @@
+package executor
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/krzko/restmigrate/internal/migration"
+	client "github.com/krzko/restmigrate/pkg/rest"
+)
+
+// apiServer is an in-memory admin API. It stores the bodies written with PUT,
+// answers GET with them or 404, and records every request as "METHOD path".
+type apiServer struct {
+	mu        sync.Mutex
+	requests  []string
+	resources map[string]string
+	// fail answers the given requests with 500.
+	fail map[string]bool
+	// responses holds the bodies returned for POST and PATCH requests.
+	responses map[string]string
+}
+
+func newAPIServer(t *testing.T) (*apiServer, client.Client) {
+	t.Helper()
+	api, baseURL := startAPIServer(t)
+	apiClient, err := client.NewClient("generic", baseURL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api, apiClient
+}
+
+// startAPIServer serves an empty apiServer and returns its URL.
+func startAPIServer(t *testing.T) (*apiServer, string) {
+	t.Helper()
+	api := &apiServer{resources: make(map[string]string), fail: make(map[string]bool), responses: make(map[string]string)}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return api, srv.URL
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request := r.Method + " " + r.URL.Path
+	s.requests = append(s.requests, request)
+	if s.fail[request] {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	switch r.Method {
+	case http.MethodGet:
+		resource, ok := s.resources[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(resource))
+	case http.MethodPut:
+		s.resources[r.URL.Path] = string(body)
+		w.Write(body)
+	case http.MethodDelete:
+		delete(s.resources, r.URL.Path)
+	default:
+		response, ok := s.responses[request]
+		if !ok {
+			response = "{}"
+		}
+		w.Write([]byte(response))
+	}
+}
+
+// sent returns the requests received, excluding GETs.
+func (s *apiServer) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sent []string
+	for _, r := range s.requests {
+		if !strings.HasPrefix(r, http.MethodGet+" ") {
+			sent = append(sent, r)
+		}
+	}
+	return sent
+}
+
+func newTestState(t *testing.T) *migration.State {
+	t.Helper()
+	backend, err := migration.NewStateBackend("", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := migration.LoadState(context.Background(), backend, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func steps(requests ...string) []migration.Step {
+	var steps []migration.Step
+	for _, r := range requests {
+		method, path, _ := strings.Cut(r, " ")
+		steps = append(steps, migration.Step{Method: method, Path: path})
+	}
+	return steps
+}
+
+func TestRollbackSteps(t *testing.T) {
+	captureService := steps("POST /services", "PUT /routes/r")
+	captureService[0].Capture = map[string]string{"service_id": "$.id"}
+
+	tests := []struct {
+		name       string
+		up         []migration.Step
+		down       []migration.Step
+		fail       string
+		noRollback bool
+		want       []string
+		wantErr    string
+	}{
+		{
+			name: "compensates in reverse",
+			up:   steps("PUT /a", "PUT /b", "PUT /c"),
+			down: steps("DELETE /c", "DELETE /b", "DELETE /a"),
+			fail: "PUT /c",
+			want: []string{"PUT /a", "PUT /b", "PUT /c", "DELETE /b", "DELETE /a"},
+		},
+		{
+			name: "first step failed",
+			up:   steps("PUT /a", "PUT /b"),
+			down: steps("DELETE /b", "DELETE /a"),
+			fail: "PUT /a",
+			want: []string{"PUT /a"},
+		},
+		{
+			name:    "step count mismatch",
+			up:      steps("PUT /a", "PUT /b"),
+			down:    steps("DELETE /a"),
+			fail:    "PUT /b",
+			want:    []string{"PUT /a", "PUT /b"},
+			wantErr: "up has 2 steps but down has 1",
+		},
+		{
+			// The request of the step was sent, only the capture failed.
+			name: "capture failure",
+			up:   captureService,
+			down: steps("DELETE /routes/r", "DELETE /services/s"),
+			want: []string{"POST /services", "DELETE /services/s"},
+		},
+		{
+			name:       "no rollback",
+			up:         steps("PUT /a", "PUT /b", "PUT /c"),
+			down:       steps("DELETE /c", "DELETE /b", "DELETE /a"),
+			fail:       "PUT /c",
+			noRollback: true,
+			want:       []string{"PUT /a", "PUT /b", "PUT /c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, apiClient := newAPIServer(t)
+			api.fail[tt.fail] = true
+			state := newTestState(t)
+			m := migration.Migration{Timestamp: 100, Name: "create_service", Up: migration.Actions{Steps: tt.up}, Down: migration.Actions{Steps: tt.down}}
+
+			err := applyMigrations(context.Background(), state, apiClient, []migration.Migration{m}, runOptions{noRollback: tt.noRollback, skipVerify: true})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want %q", err, tt.wantErr)
+			}
+			if got := api.sent(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %v, want %v", got, tt.want)
+			}
+			if len(state.AppliedMigrations) != 0 {
+				t.Errorf("failed migration was recorded: %+v", state.AppliedMigrations)
+			}
+		})
+	}
+}
+
+func TestRollbackStepsReportsFailedCompensation(t *testing.T) {
+	api, apiClient := newAPIServer(t)
+	api.fail["PUT /c"] = true
+	api.fail["DELETE /b"] = true
+	m := migration.Migration{Name: "create_service", Up: migration.Actions{Steps: steps("PUT /a", "PUT /b", "PUT /c")}, Down: migration.Actions{Steps: steps("DELETE /c", "DELETE /b", "DELETE /a")}}
+
+	err := rollbackSteps(context.Background(), apiClient, m, 2, map[string]interface{}{}, runOptions{})
+	if err == nil || !strings.Contains(err.Error(), "compensated 1 of 2 step(s), failed steps: [1]") {
+		t.Errorf("got %v", err)
+	}
+	// A failed compensation does not stop the others.
+	if got, want := api.sent(), []string{"DELETE /b", "DELETE /a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+}
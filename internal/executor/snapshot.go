@@ -0,0 +1,164 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/krzko/restmigrate/internal/migration"
+	"github.com/krzko/restmigrate/internal/telemetry"
+	"github.com/krzko/restmigrate/pkg/rest"
+	client "github.com/krzko/restmigrate/pkg/rest"
+)
+
+// snapshotRecorder takes a snapshot of each resource before the first step of
+// a migration declared with down: "auto" changes it.
+type snapshotRecorder struct {
+	gatewayType string
+	snapshots   []migration.Snapshot
+	seen        map[string]bool
+}
+
+// newSnapshotRecorder returns a recorder for m, or nil when m does not revert
+// from snapshots. Dry runs send no requests and take no snapshots.
+func newSnapshotRecorder(m migration.Migration, opts runOptions) *snapshotRecorder {
+	if !m.Down.Auto || opts.dryRun {
+		return nil
+	}
+	return &snapshotRecorder{gatewayType: opts.gatewayType, seen: make(map[string]bool)}
+}
+
+// record fetches the resource step is about to change, unless an earlier step
+// of the migration already changed it.
+func (r *snapshotRecorder) record(ctx context.Context, apiClient client.Client, step migration.Step) error {
+	if r == nil || !changesResource(step) || r.seen[step.Path] {
+		return nil
+	}
+
+	logger.Debug("Taking snapshot", "path", step.Path)
+	resp, err := apiClient.SendRequest(ctx, rest.Request{
+		Method:       http.MethodGet,
+		Endpoint:     step.Path,
+		Headers:      step.Headers,
+		IgnoreStatus: []int{http.StatusNotFound},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to take snapshot of %s: %w", step.Path, err)
+	}
+
+	snapshot := migration.Snapshot{
+		Path:    step.Path,
+		Headers: step.Headers,
+		Exists:  resp.StatusCode != http.StatusNotFound,
+	}
+	if snapshot.Exists {
+		snapshot.Body, err = client.DecodeResource(r.gatewayType, resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to take snapshot of %s: %w", step.Path, err)
+		}
+	}
+
+	r.seen[step.Path] = true
+	r.snapshots = append(r.snapshots, snapshot)
+	return nil
+}
+
+// taken returns the snapshots recorded so far.
+func (r *snapshotRecorder) taken() []migration.Snapshot {
+	if r == nil {
+		return nil
+	}
+	return r.snapshots
+}
+
+func changesResource(step migration.Step) bool {
+	switch step.Method {
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// downActions returns the steps that revert m. A down block declared as
+// "auto" restores the snapshots recorded in state when m was applied.
+func downActions(state *migration.State, m migration.Migration, gatewayType string) (migration.Actions, error) {
+	if !m.Down.Auto {
+		return m.Down, nil
+	}
+
+	snapshots := state.Snapshots(m.Timestamp)
+	if len(snapshots) == 0 {
+		for _, step := range m.Up.Steps {
+			if changesResource(step) {
+				return migration.Actions{}, fmt.Errorf("no snapshots recorded for %s, it has to be reverted by hand", m.Name)
+			}
+		}
+	}
+	return migration.Actions{Steps: restoreSteps(gatewayType, snapshots)}, nil
+}
+
+// restoreSteps puts the snapshots back in reverse order. Resources that did
+// not exist are deleted, the others are replaced with their previous body.
+func restoreSteps(gatewayType string, snapshots []migration.Snapshot) []migration.Step {
+	// Caddy creates with PUT and replaces an existing value with PATCH.
+	method := http.MethodPut
+	if gatewayType == "caddy" {
+		method = http.MethodPatch
+	}
+
+	steps := make([]migration.Step, 0, len(snapshots))
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		snapshot := snapshots[i]
+		if !snapshot.Exists {
+			steps = append(steps, migration.Step{
+				Method:       http.MethodDelete,
+				Path:         snapshot.Path,
+				Headers:      snapshot.Headers,
+				IgnoreStatus: []int{http.StatusNotFound},
+			})
+			continue
+		}
+		steps = append(steps, migration.Step{
+			Method:  method,
+			Path:    snapshot.Path,
+			Body:    snapshot.Body,
+			Headers: snapshot.Headers,
+		})
+	}
+	return steps
+}
+
+// rollbackSnapshots restores the snapshots taken before a migration declared
+// with down: "auto" failed part way. The resource of the failed step is
+// restored as well, as it may have been changed before the error.
+func rollbackSnapshots(ctx context.Context, apiClient client.Client, m migration.Migration, snapshots []migration.Snapshot, captures map[string]interface{}, opts runOptions) error {
+	ctx, span := telemetry.StartSpan(ctx, "RollbackMigration")
+	defer span.End()
+
+	if len(snapshots) == 0 {
+		logger.Info("No steps to roll back", "name", m.Name)
+		return nil
+	}
+
+	logger.Warn("Restoring snapshots", "name", m.Name, "snapshots", len(snapshots))
+	var errs []error
+	for _, step := range restoreSteps(opts.gatewayType, snapshots) {
+		_, err := applyMigration(ctx, apiClient, migration.Actions{Steps: []migration.Step{step}}, captures, nil, opts)
+		if err != nil {
+			logger.Error("Failed to restore snapshot", "path", step.Path, "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		err := fmt.Errorf("rollback of %s incomplete: %w", m.Name, errors.Join(errs...))
+		telemetry.SetSpanStatus(span, err)
+		return err
+	}
+
+	logger.Info("Rolled back migration", "name", m.Name, "restored", len(snapshots))
+	return nil
+}
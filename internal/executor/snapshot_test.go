@@ -0,0 +1,148 @@
+package executor
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/krzko/restmigrate/internal/migration"
+)
+
+func TestSnapshotRecorderRecord(t *testing.T) {
+	api, apiClient := newAPIServer(t)
+	api.resources["/services/a"] = `{"name":"a","port":80}`
+
+	m := migration.Migration{
+		Timestamp: 100,
+		Name:      "update_services",
+		Up:        migration.Actions{Steps: steps("PUT /services/a", "PATCH /services/a", "PUT /services/b", "GET /services/c", "DELETE /services/a")},
+		Down:      migration.Actions{Auto: true},
+	}
+	recorder := newSnapshotRecorder(m, runOptions{gatewayType: "generic"})
+	for _, step := range m.Up.Steps {
+		if err := recorder.record(context.Background(), apiClient, step); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	want := []migration.Snapshot{
+		{Path: "/services/a", Exists: true, Body: map[string]interface{}{"name": "a", "port": float64(80)}},
+		{Path: "/services/b", Exists: false},
+	}
+	if got := recorder.taken(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got snapshots %+v, want %+v", got, want)
+	}
+	// Only the first change to each path is fetched.
+	wantRequests := []string{"GET /services/a", "GET /services/b"}
+	if !reflect.DeepEqual(api.requests, wantRequests) {
+		t.Errorf("got requests %v, want %v", api.requests, wantRequests)
+	}
+}
+
+func TestNewSnapshotRecorder(t *testing.T) {
+	auto := migration.Migration{Down: migration.Actions{Auto: true}}
+	if newSnapshotRecorder(auto, runOptions{}) == nil {
+		t.Error("expected a recorder for down \"auto\"")
+	}
+	if newSnapshotRecorder(auto, runOptions{dryRun: true}) != nil {
+		t.Error("expected no recorder for a dry run")
+	}
+	if newSnapshotRecorder(migration.Migration{}, runOptions{}) != nil {
+		t.Error("expected no recorder without down \"auto\"")
+	}
+}
+
+func TestRestoreSteps(t *testing.T) {
+	body := map[string]interface{}{"name": "a"}
+	snapshots := []migration.Snapshot{
+		{Path: "/services/a", Exists: true, Body: body},
+		{Path: "/services/b", Exists: false},
+		{Path: "/routes/r", Exists: true, Body: body, Headers: map[string]string{"X-Workspace": "w"}},
+	}
+
+	tests := []struct {
+		gatewayType string
+		want        []migration.Step
+	}{
+		{
+			gatewayType: "generic",
+			want: []migration.Step{
+				{Method: http.MethodPut, Path: "/routes/r", Body: body, Headers: map[string]string{"X-Workspace": "w"}},
+				{Method: http.MethodDelete, Path: "/services/b", IgnoreStatus: []int{http.StatusNotFound}},
+				{Method: http.MethodPut, Path: "/services/a", Body: body},
+			},
+		},
+		{
+			gatewayType: "caddy",
+			want: []migration.Step{
+				{Method: http.MethodPatch, Path: "/routes/r", Body: body, Headers: map[string]string{"X-Workspace": "w"}},
+				{Method: http.MethodDelete, Path: "/services/b", IgnoreStatus: []int{http.StatusNotFound}},
+				{Method: http.MethodPatch, Path: "/services/a", Body: body},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.gatewayType, func(t *testing.T) {
+			if got := restoreSteps(tt.gatewayType, snapshots); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got steps %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownActions(t *testing.T) {
+	snapshots := []migration.Snapshot{{Path: "/services/a", Exists: false}}
+	state := newTestState(t)
+	state.AddMigration(100, "create_service", "")
+	state.SetSnapshots(100, snapshots)
+	state.AddMigration(200, "update_service", "")
+	state.AddMigration(300, "read_service", "")
+
+	tests := []struct {
+		name    string
+		m       migration.Migration
+		want    []migration.Step
+		wantErr string
+	}{
+		{
+			name: "declared steps",
+			m:    migration.Migration{Timestamp: 100, Name: "create_service", Down: migration.Actions{Steps: steps("DELETE /services/a")}},
+			want: steps("DELETE /services/a"),
+		},
+		{
+			name: "restores snapshots",
+			m:    migration.Migration{Timestamp: 100, Name: "create_service", Up: migration.Actions{Steps: steps("PUT /services/a")}, Down: migration.Actions{Auto: true}},
+			want: restoreSteps("generic", snapshots),
+		},
+		{
+			name:    "no snapshots",
+			m:       migration.Migration{Timestamp: 200, Name: "update_service", Up: migration.Actions{Steps: steps("PUT /services/a")}, Down: migration.Actions{Auto: true}},
+			wantErr: "no snapshots recorded for update_service",
+		},
+		{
+			name: "nothing changed",
+			m:    migration.Migration{Timestamp: 300, Name: "read_service", Up: migration.Actions{Steps: steps("GET /services/a")}, Down: migration.Actions{Auto: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := downActions(state, tt.m, "generic")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got.Steps) != len(tt.want) || len(tt.want) > 0 && !reflect.DeepEqual(got.Steps, tt.want) {
+				t.Errorf("got steps %+v, want %+v", got.Steps, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/krzko/restmigrate/internal/migration"
+	"github.com/krzko/restmigrate/internal/telemetry"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	statusApplied    = "applied"
+	statusPending    = "pending"
+	statusMissing    = "missing"
+	statusModified   = "modified"
+	statusOutOfOrder = "out-of-order"
+)
+
+type migrationStatus struct {
+	Timestamp int64
+	Name      string
+	Status    string
+}
+
+func ShowStatus(ctx context.Context, c *cli.Context) error {
+	ctx, span := telemetry.StartSpan(ctx, "ShowStatus")
+	defer span.End()
+
+	logger.Debug("Starting ShowStatus")
+	path := c.String("path")
+
+	state, err := loadState(ctx, c)
+	if err != nil {
+		logger.Error("Failed to load state", "error", err)
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	vars, err := migrationVars(c)
+	if err != nil {
+		return err
+	}
+
+	migrations, err := loadMigrations(path, vars)
+	if err != nil {
+		logger.Error("Failed to load migrations", "error", err)
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	mismatches, err := checksumMismatches(state, migrations)
+	if err != nil {
+		return err
+	}
+
+	statuses := resolveStatuses(state, migrations, mismatches)
+	if len(statuses) == 0 {
+		logger.Info("No migrations found")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Status", "Timestamp", "Date", "Name"})
+	table.SetBorder(false)
+	table.SetColumnSeparator(" ")
+
+	counts := make(map[string]int)
+	for _, s := range statuses {
+		counts[s.Status]++
+		date := time.Unix(s.Timestamp, 0).Format("2006-01-02 15:04:05")
+		table.Append([]string{
+			s.Status,
+			fmt.Sprintf("%d", s.Timestamp),
+			date,
+			s.Name,
+		})
+	}
+
+	logger.Info("Migration status",
+		statusApplied, counts[statusApplied],
+		statusPending, counts[statusPending],
+		statusMissing, counts[statusMissing],
+		statusModified, counts[statusModified],
+		statusOutOfOrder, counts[statusOutOfOrder])
+	table.Render()
+
+	if c.Bool("exit-code") {
+		unapplied := counts[statusPending] + counts[statusMissing] + counts[statusOutOfOrder]
+		if unapplied > 0 {
+			return fmt.Errorf("%d migration(s) are not in the applied state", unapplied)
+		}
+	}
+
+	err = verifyChecksums(state, migrations, c.String("checksum-mismatch"))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// resolveStatuses joins the applied migrations in state with the migration
+// files on disk, ordered by timestamp.
+func resolveStatuses(state *migration.State, migrations, modified []migration.Migration) []migrationStatus {
+	var newestApplied int64
+	for _, m := range state.AppliedMigrations {
+		if m.Timestamp > newestApplied {
+			newestApplied = m.Timestamp
+		}
+	}
+
+	changed := make(map[int64]bool, len(modified))
+	for _, m := range modified {
+		changed[m.Timestamp] = true
+	}
+
+	files := make(map[int64]bool, len(migrations))
+	var statuses []migrationStatus
+	for _, m := range migrations {
+		files[m.Timestamp] = true
+
+		status := statusPending
+		switch {
+		case changed[m.Timestamp]:
+			status = statusModified
+		case containsMigration(state.AppliedMigrations, m.Timestamp):
+			status = statusApplied
+		case m.Timestamp < newestApplied:
+			status = statusOutOfOrder
+		}
+		statuses = append(statuses, migrationStatus{
+			Timestamp: m.Timestamp,
+			Name:      m.Name,
+			Status:    status,
+		})
+	}
+
+	for _, m := range state.AppliedMigrations {
+		if !files[m.Timestamp] {
+			statuses = append(statuses, migrationStatus{
+				Timestamp: m.Timestamp,
+				Name:      m.Name,
+				Status:    statusMissing,
+			})
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Timestamp < statuses[j].Timestamp
+	})
+
+	return statuses
+}
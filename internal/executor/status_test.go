@@ -0,0 +1,90 @@
+package executor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/krzko/restmigrate/internal/migration"
+)
+
+func TestResolveStatuses(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []int64
+		applied  []int64
+		modified []int64
+		want     []migrationStatus
+	}{
+		{
+			name:  "nothing applied",
+			files: []int64{100, 200},
+			want: []migrationStatus{
+				{Timestamp: 100, Name: "create_service", Status: statusPending},
+				{Timestamp: 200, Name: "create_route", Status: statusPending},
+			},
+		},
+		{
+			name:    "applied and pending",
+			files:   []int64{100, 200, 300},
+			applied: []int64{100},
+			want: []migrationStatus{
+				{Timestamp: 100, Name: "create_service", Status: statusApplied},
+				{Timestamp: 200, Name: "create_route", Status: statusPending},
+				{Timestamp: 300, Name: "add_plugin", Status: statusPending},
+			},
+		},
+		{
+			name:    "out of order",
+			files:   []int64{100, 200, 300},
+			applied: []int64{100, 300},
+			want: []migrationStatus{
+				{Timestamp: 100, Name: "create_service", Status: statusApplied},
+				{Timestamp: 200, Name: "create_route", Status: statusOutOfOrder},
+				{Timestamp: 300, Name: "add_plugin", Status: statusApplied},
+			},
+		},
+		{
+			name:    "missing file",
+			files:   []int64{100, 300},
+			applied: []int64{100, 200},
+			want: []migrationStatus{
+				{Timestamp: 100, Name: "create_service", Status: statusApplied},
+				{Timestamp: 200, Name: "create_route", Status: statusMissing},
+				{Timestamp: 300, Name: "add_plugin", Status: statusPending},
+			},
+		},
+		{
+			name:     "modified",
+			files:    []int64{100, 200},
+			applied:  []int64{100, 200},
+			modified: []int64{200},
+			want: []migrationStatus{
+				{Timestamp: 100, Name: "create_service", Status: statusApplied},
+				{Timestamp: 200, Name: "create_route", Status: statusModified},
+			},
+		},
+		{name: "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveStatuses(appliedState(tt.applied...), selectMigrations(tt.files...), selectMigrations(tt.modified...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// selectMigrations returns the target migrations with the given timestamps.
+func selectMigrations(timestamps ...int64) []migration.Migration {
+	var selected []migration.Migration
+	for _, ts := range timestamps {
+		for _, m := range targetMigrations {
+			if m.Timestamp == ts {
+				selected = append(selected, m)
+			}
+		}
+	}
+	return selected
+}
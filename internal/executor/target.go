@@ -0,0 +1,109 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/krzko/restmigrate/internal/migration"
+)
+
+// selectPending returns the migrations up applies: all pending migrations, the
+// pending ones up to and including the target given with --to, or the next
+// steps pending ones.
+func selectPending(state *migration.State, migrations []migration.Migration, to string, steps int) ([]migration.Migration, error) {
+	if to != "" && steps != 0 {
+		return nil, fmt.Errorf("--to and --steps cannot be combined")
+	}
+	if steps < 0 {
+		return nil, fmt.Errorf("--steps must be positive")
+	}
+
+	var limit int64 = -1
+	if to != "" {
+		i, err := findTarget(to, len(migrations), func(i int) (int64, string) {
+			return migrations[i].Timestamp, migrations[i].Name
+		})
+		if err != nil {
+			return nil, err
+		}
+		limit = migrations[i].Timestamp
+	}
+
+	var pending []migration.Migration
+	for _, m := range migrations {
+		if containsMigration(state.AppliedMigrations, m.Timestamp) {
+			logger.Debug("Skipping already applied migration", "name", m.Name)
+			continue
+		}
+		if limit >= 0 && m.Timestamp > limit {
+			logger.Debug("Skipping migration after target", "name", m.Name, "target", to)
+			continue
+		}
+		pending = append(pending, m)
+	}
+
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+	return pending, nil
+}
+
+// revertCount returns how many of the newest applied migrations down reverts:
+// all of them, those applied after the target given with --to, the last steps
+// ones, or by default the last one.
+func revertCount(state *migration.State, all bool, to string, steps int) (int, error) {
+	selected := 0
+	for _, set := range []bool{all, to != "", steps != 0} {
+		if set {
+			selected++
+		}
+	}
+	if selected > 1 {
+		return 0, fmt.Errorf("--all, --to and --steps cannot be combined")
+	}
+	if steps < 0 {
+		return 0, fmt.Errorf("--steps must be positive")
+	}
+
+	applied := len(state.AppliedMigrations)
+	switch {
+	case all:
+		return applied, nil
+	case to != "":
+		i, err := findTarget(to, applied, func(i int) (int64, string) {
+			return state.AppliedMigrations[i].Timestamp, state.AppliedMigrations[i].Name
+		})
+		if err != nil {
+			return 0, fmt.Errorf("%w among the applied migrations", err)
+		}
+		// The target itself stays applied.
+		return applied - 1 - i, nil
+	case steps > 0:
+		return min(steps, applied), nil
+	default:
+		return min(1, applied), nil
+	}
+}
+
+// findTarget returns the index of the migration given as a timestamp or name.
+// at returns the timestamp and name of the migration at index i.
+func findTarget(target string, n int, at func(i int) (int64, string)) (int, error) {
+	timestamp, err := strconv.ParseInt(target, 10, 64)
+	byTimestamp := err == nil
+
+	found := -1
+	for i := 0; i < n; i++ {
+		ts, name := at(i)
+		if byTimestamp && ts == timestamp || !byTimestamp && name == target {
+			if found >= 0 {
+				return 0, fmt.Errorf("target migration %s is ambiguous, use its timestamp", target)
+			}
+			found = i
+		}
+	}
+	if found < 0 {
+		return 0, fmt.Errorf("target migration %s not found", target)
+	}
+	return found, nil
+}
@@ -0,0 +1,117 @@
+package executor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/krzko/restmigrate/internal/migration"
+)
+
+var targetMigrations = []migration.Migration{
+	{Timestamp: 100, Name: "create_service"},
+	{Timestamp: 200, Name: "create_route"},
+	{Timestamp: 300, Name: "add_plugin"},
+	{Timestamp: 400, Name: "add_plugin"},
+	{Timestamp: 500, Name: "update_route"},
+}
+
+func appliedState(timestamps ...int64) *migration.State {
+	state := &migration.State{}
+	for _, ts := range timestamps {
+		for _, m := range targetMigrations {
+			if m.Timestamp == ts {
+				state.AppliedMigrations = append(state.AppliedMigrations, migration.AppliedMigration{Timestamp: ts, Name: m.Name})
+			}
+		}
+	}
+	return state
+}
+
+func TestSelectPending(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied []int64
+		to      string
+		steps   int
+		want    []int64
+		wantErr string
+	}{
+		{name: "all pending", applied: []int64{100}, want: []int64{200, 300, 400, 500}},
+		{name: "nothing pending", applied: []int64{100, 200, 300, 400, 500}},
+		{name: "to name", to: "create_route", want: []int64{100, 200}},
+		{name: "to timestamp", applied: []int64{100}, to: "300", want: []int64{200, 300}},
+		{name: "to applied target", applied: []int64{100, 200}, to: "create_service"},
+		{name: "to skips gaps", applied: []int64{100, 300}, to: "400", want: []int64{200, 400}},
+		{name: "steps", applied: []int64{100}, steps: 2, want: []int64{200, 300}},
+		{name: "steps beyond pending", applied: []int64{100, 200, 300}, steps: 5, want: []int64{400, 500}},
+		{name: "ambiguous name", to: "add_plugin", wantErr: "target migration add_plugin is ambiguous, use its timestamp"},
+		{name: "unknown target", to: "drop_route", wantErr: "target migration drop_route not found"},
+		{name: "unknown timestamp", to: "150", wantErr: "target migration 150 not found"},
+		{name: "to and steps", to: "create_route", steps: 1, wantErr: "--to and --steps cannot be combined"},
+		{name: "negative steps", steps: -1, wantErr: "--steps must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending, err := selectPending(appliedState(tt.applied...), targetMigrations, tt.to, tt.steps)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []int64
+			for _, m := range pending {
+				got = append(got, m.Timestamp)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevertCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied []int64
+		all     bool
+		to      string
+		steps   int
+		want    int
+		wantErr string
+	}{
+		{name: "last by default", applied: []int64{100, 200, 300}, want: 1},
+		{name: "nothing applied", want: 0},
+		{name: "all", applied: []int64{100, 200, 300}, all: true, want: 3},
+		{name: "to keeps target", applied: []int64{100, 200, 300}, to: "create_service", want: 2},
+		{name: "to newest", applied: []int64{100, 200, 300}, to: "300", want: 0},
+		{name: "steps", applied: []int64{100, 200, 300}, steps: 2, want: 2},
+		{name: "steps beyond applied", applied: []int64{100, 200}, steps: 5, want: 2},
+		{name: "to not applied", applied: []int64{100, 200}, to: "update_route", wantErr: "target migration update_route not found among the applied migrations"},
+		{name: "all and to", all: true, to: "100", wantErr: "--all, --to and --steps cannot be combined"},
+		{name: "all and steps", all: true, steps: 1, wantErr: "--all, --to and --steps cannot be combined"},
+		{name: "negative steps", steps: -2, wantErr: "--steps must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := revertCount(appliedState(tt.applied...), tt.all, tt.to, tt.steps)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/krzko/restmigrate/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// varEnvPrefix marks environment variables injected into migrations, e.g.
+// RESTMIGRATE_VAR_UPSTREAM_HOST sets the upstream_host variable.
+const varEnvPrefix = "RESTMIGRATE_VAR_"
+
+// migrationVars collects the variables injected into migrations through
+// @tag() attributes. From lowest to highest precedence they come from the
+// selected project environment, --var-file, RESTMIGRATE_VAR_* environment
+// variables and --var flags.
+func migrationVars(c *cli.Context) (map[string]string, error) {
+	vars := make(map[string]string)
+
+	if env := config.FromContext(c); env != nil {
+		for _, file := range env.VarFiles {
+			if err := readVarFile(file, vars); err != nil {
+				return nil, err
+			}
+		}
+		for key, value := range env.Vars {
+			vars[key] = value
+		}
+	}
+
+	for _, file := range c.StringSlice("var-file") {
+		if err := readVarFile(file, vars); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		if name, ok := strings.CutPrefix(key, varEnvPrefix); ok && name != "" {
+			vars[strings.ToLower(name)] = value
+		}
+	}
+
+	for _, v := range c.StringSlice("var") {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid variable %q, expected key=value", v)
+		}
+		vars[strings.TrimSpace(key)] = value
+	}
+
+	return vars, nil
+}
+
+// readVarFile reads key=value lines from path into vars. Blank lines and lines
+// starting with # are ignored, values may be wrapped in double quotes.
+func readVarFile(path string, vars map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open variable file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("%s:%d: expected key=value", path, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+			value = value[1 : len(value)-1]
+		}
+		vars[strings.TrimSpace(key)] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read variable file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/krzko/restmigrate/internal/migration"
+	"github.com/krzko/restmigrate/internal/telemetry"
+	"github.com/krzko/restmigrate/pkg/rest"
+	client "github.com/krzko/restmigrate/pkg/rest"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli/v2"
+)
+
+// VerifyMigrations runs the verify checks of the applied migrations against
+// the API and fails if any of them does not pass.
+func VerifyMigrations(ctx context.Context, c *cli.Context) error {
+	ctx, span := telemetry.StartSpan(ctx, "VerifyMigrations")
+	defer span.End()
+
+	logger.Debug("Starting VerifyMigrations")
+	opts, err := newRunOptions(c)
+	if err != nil {
+		return err
+	}
+
+	state, err := loadState(ctx, c)
+	if err != nil {
+		logger.Error("Failed to load state", "error", err)
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	migrations, err := loadMigrations(opts.path, opts.vars)
+	if err != nil {
+		logger.Error("Failed to load migrations", "error", err)
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	apiClient, err := newAPIClient(c, opts)
+	if err != nil {
+		logger.Error("Failed to create API client", "error", err)
+		return fmt.Errorf("failed to create API client: %w", err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Result", "Timestamp", "Name", "Check", "Details"})
+	table.SetBorder(false)
+	table.SetColumnSeparator(" ")
+	table.SetAutoWrapText(false)
+
+	captures := state.Captures()
+	var checked, failed int
+	for _, m := range migrations {
+		if !containsMigration(state.AppliedMigrations, m.Timestamp) || len(m.Verify) == 0 {
+			continue
+		}
+		for i, check := range m.Verify {
+			checked++
+			result, details := "ok", ""
+			if err := runCheck(ctx, apiClient, check, captures); err != nil {
+				failed++
+				result, details = "failed", err.Error()
+			}
+			table.Append([]string{
+				result,
+				fmt.Sprintf("%d", m.Timestamp),
+				m.Name,
+				fmt.Sprintf("%d: %s %s", i, check.Method, check.Path),
+				details,
+			})
+		}
+	}
+
+	if checked == 0 {
+		logger.Info("No verify checks found for the applied migrations")
+		return nil
+	}
+
+	logger.Info("Verification results", "checks", checked, "failed", failed)
+	table.Render()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d verify check(s) failed", failed, checked)
+	}
+	return nil
+}
+
+// verifyMigration runs the verify checks of m once it has been applied. The
+// migration stays recorded in the state when a check fails, as its requests
+// were applied.
+func verifyMigration(ctx context.Context, apiClient client.Client, m migration.Migration, captures map[string]interface{}) error {
+	if len(m.Verify) == 0 {
+		return nil
+	}
+
+	ctx, span := telemetry.StartSpan(ctx, "VerifyMigration")
+	defer span.End()
+
+	logger.Info("Verifying migration", "name", m.Name, "checks", len(m.Verify))
+	var errs []error
+	for i, check := range m.Verify {
+		if err := runCheck(ctx, apiClient, check, captures); err != nil {
+			logger.Error("Verify check failed", "name", m.Name, "check", i, "path", check.Path, "error", err)
+			errs = append(errs, fmt.Errorf("check %d (%s %s): %w", i, check.Method, check.Path, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("verification failed for %s: %w", m.Name, errors.Join(errs...))
+	}
+	return nil
+}
+
+// runCheck sends the request of check and evaluates the response against its
+// constraints.
+func runCheck(ctx context.Context, apiClient client.Client, check migration.Check, captures map[string]interface{}) error {
+	step, err := check.Step().Resolve(captures, false)
+	if err != nil {
+		return fmt.Errorf("failed to resolve check: %w", err)
+	}
+
+	logger.Debug("Running verify check", "method", step.Method, "path", step.Path)
+	resp, err := apiClient.SendRequest(ctx, rest.Request{
+		Method:   step.Method,
+		Endpoint: step.Path,
+		Headers:  step.Headers,
+		Expect:   step.Expect,
+	})
+	if err != nil {
+		if errorResp, ok := err.(*rest.ErrorResponse); ok {
+			return fmt.Errorf("unexpected status %d", errorResp.StatusCode)
+		}
+		return err
+	}
+
+	return check.Evaluate(resp.Body)
+}
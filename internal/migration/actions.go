@@ -0,0 +1,143 @@
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Step is a single HTTP request executed as part of a migration. Capture maps
+// a name to a path in the JSON response, the captured value can be referenced
+// as ${name} in the path, headers and body of later steps.
+//
+// A step succeeds with a 2xx status by default. Expect replaces the statuses
+// that count as success, IgnoreStatus adds to them, e.g. 409 for a resource
+// that already exists or 404 for one that is already gone.
+type Step struct {
+	Method       string            `json:"method"`
+	Path         string            `json:"path"`
+	Body         interface{}       `json:"body,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Capture      map[string]string `json:"capture,omitempty"`
+	Expect       []int             `json:"expect,omitempty"`
+	IgnoreStatus []int             `json:"ignore_status,omitempty"`
+}
+
+// Actions holds the ordered steps of an up or down block. It accepts both the
+// `steps: [...]` list form and the legacy form keyed by endpoint. A down block
+// declared as "auto" has no steps, it restores the resources from the
+// snapshots taken before up changed them.
+type Actions struct {
+	Steps []Step `json:"steps"`
+	Auto  bool   `json:"auto,omitempty"`
+}
+
+func (a *Actions) UnmarshalJSON(data []byte) error {
+	var keyword string
+	if err := json.Unmarshal(data, &keyword); err == nil {
+		if keyword != "auto" {
+			return fmt.Errorf("actions must be an object or \"auto\", got %q", keyword)
+		}
+		a.Auto = true
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("actions must be an object: %w", err)
+	}
+
+	if raw, ok := fields["steps"]; ok {
+		if len(fields) > 1 {
+			return fmt.Errorf("steps cannot be combined with endpoint keyed actions")
+		}
+		var steps []Step
+		if err := json.Unmarshal(raw, &steps); err != nil {
+			return fmt.Errorf("invalid steps: %w", err)
+		}
+		for i := range steps {
+			if err := steps[i].validate(); err != nil {
+				return fmt.Errorf("invalid step %d: %w", i, err)
+			}
+		}
+		a.Steps = steps
+		return nil
+	}
+
+	steps, err := parseLegacyActions(data)
+	if err != nil {
+		return err
+	}
+	a.Steps = steps
+	return nil
+}
+
+// parseLegacyActions decodes the endpoint keyed form, keeping the order in
+// which the endpoints were declared.
+func parseLegacyActions(data []byte) ([]Step, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	// Consume the opening delimiter of the object.
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	var steps []Step
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		endpoint, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid endpoint key %v", token)
+		}
+
+		var action struct {
+			Method       string            `json:"method"`
+			Body         interface{}       `json:"body"`
+			Headers      map[string]string `json:"headers"`
+			Capture      map[string]string `json:"capture"`
+			Expect       []int             `json:"expect"`
+			IgnoreStatus []int             `json:"ignore_status"`
+		}
+		if err := dec.Decode(&action); err != nil {
+			return nil, fmt.Errorf("invalid action format for endpoint %s: %w", endpoint, err)
+		}
+
+		step := Step{
+			Method:       action.Method,
+			Path:         endpoint,
+			Body:         action.Body,
+			Headers:      action.Headers,
+			Capture:      action.Capture,
+			Expect:       action.Expect,
+			IgnoreStatus: action.IgnoreStatus,
+		}
+		if err := step.validate(); err != nil {
+			return nil, fmt.Errorf("invalid action for endpoint %s: %w", endpoint, err)
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+func (s *Step) validate() error {
+	if s.Method == "" {
+		return fmt.Errorf("missing or invalid method")
+	}
+	if s.Path == "" {
+		return fmt.Errorf("missing path")
+	}
+	for _, statuses := range [][]int{s.Expect, s.IgnoreStatus} {
+		for _, status := range statuses {
+			if status < 100 || status > 599 {
+				return fmt.Errorf("invalid HTTP status %d", status)
+			}
+		}
+	}
+	s.Method = strings.ToUpper(s.Method)
+	return nil
+}
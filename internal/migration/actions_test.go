@@ -0,0 +1,95 @@
+package migration
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestActionsUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Actions
+		wantErr bool
+	}{
+		{
+			name: "legacy form keeps declaration order",
+			data: `{
+				"/services/b": {"method": "put", "body": {"name": "b"}},
+				"/services/a": {"method": "PUT", "body": {"name": "a"}},
+				"/routes/c": {"method": "delete", "ignore_status": [404]}
+			}`,
+			want: Actions{Steps: []Step{
+				{Method: "PUT", Path: "/services/b", Body: map[string]interface{}{"name": "b"}},
+				{Method: "PUT", Path: "/services/a", Body: map[string]interface{}{"name": "a"}},
+				{Method: "DELETE", Path: "/routes/c", IgnoreStatus: []int{404}},
+			}},
+		},
+		{
+			name: "steps form",
+			data: `{"steps": [
+				{"method": "post", "path": "/services", "capture": {"id": "id"}},
+				{"method": "get", "path": "/services/${id}", "expect": [200]}
+			]}`,
+			want: Actions{Steps: []Step{
+				{Method: "POST", Path: "/services", Capture: map[string]string{"id": "id"}},
+				{Method: "GET", Path: "/services/${id}", Expect: []int{200}},
+			}},
+		},
+		{
+			name: "auto",
+			data: `"auto"`,
+			want: Actions{Auto: true},
+		},
+		{
+			name: "empty legacy form",
+			data: `{}`,
+			want: Actions{},
+		},
+		{
+			name:    "unknown keyword",
+			data:    `"manual"`,
+			wantErr: true,
+		},
+		{
+			name:    "steps combined with endpoints",
+			data:    `{"steps": [], "/services": {"method": "GET"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "legacy action without method",
+			data:    `{"/services": {"body": {}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "step without path",
+			data:    `{"steps": [{"method": "GET"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid status",
+			data:    `{"steps": [{"method": "GET", "path": "/", "expect": [42]}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Actions
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
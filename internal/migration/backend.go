@@ -0,0 +1,123 @@
+package migration
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/krzko/restmigrate/pkg/rest"
+)
+
+// ErrStateNotFound is returned by a StateBackend when no state has been
+// stored yet.
+var ErrStateNotFound = errors.New("state not found")
+
+// StateBackend reads and writes the serialised migration state.
+type StateBackend interface {
+	Read(ctx context.Context) ([]byte, error)
+	Write(ctx context.Context, data []byte) error
+	String() string
+}
+
+// NewStateBackend returns the backend for stateURL. An empty URL selects the
+// local state file inside the migrations path. Supported schemes are file,
+// http, https and s3, the remote ones connect with tlsConfig when it is not nil.
+func NewStateBackend(stateURL, path string, tlsConfig *tls.Config) (StateBackend, error) {
+	if stateURL == "" {
+		return &FileBackend{path: filepath.Join(path, stateFileName)}, nil
+	}
+
+	u, err := url.Parse(stateURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		filePath := u.Path
+		if u.Opaque != "" {
+			filePath = u.Opaque
+		}
+		if u.Host != "" {
+			filePath = filepath.Join(u.Host, filePath)
+		}
+		return &FileBackend{path: filePath}, nil
+	case "http", "https":
+		return newHTTPBackend(u, os.Getenv("RESTMIGRATE_STATE_TOKEN"), rest.NewHTTPClient(tlsConfig)), nil
+	case "s3":
+		return newS3Backend(u, rest.NewHTTPClient(tlsConfig))
+	default:
+		return nil, fmt.Errorf("unsupported state backend scheme: %q", u.Scheme)
+	}
+}
+
+// FileBackend stores the state in a JSON file on the local filesystem.
+type FileBackend struct {
+	path string
+}
+
+func (b *FileBackend) Read(_ context.Context) ([]byte, error) {
+	data, err := os.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return nil, ErrStateNotFound
+	}
+	return data, err
+}
+
+func (b *FileBackend) Write(_ context.Context, data []byte) error {
+	return os.WriteFile(b.path, data, 0644)
+}
+
+func (b *FileBackend) String() string {
+	return b.path
+}
+
+// CreateLock writes a lock file next to the state file, failing if it already
+// exists.
+func (b *FileBackend) CreateLock(_ context.Context, data []byte) error {
+	f, err := os.OpenFile(b.lockPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return ErrLockExists
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (b *FileBackend) ReadLock(_ context.Context) ([]byte, error) {
+	data, err := os.ReadFile(b.lockPath())
+	if os.IsNotExist(err) {
+		return nil, ErrLockNotFound
+	}
+	return data, err
+}
+
+func (b *FileBackend) DeleteLock(_ context.Context) error {
+	err := os.Remove(b.lockPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (b *FileBackend) lockPath() string {
+	return b.path + ".lock"
+}
+
+// redactURL strips credentials and query parameters from u for logging.
+func redactURL(u *url.URL) string {
+	clean := *u
+	clean.User = nil
+	clean.RawQuery = ""
+	return strings.TrimSuffix(clean.String(), "?")
+}
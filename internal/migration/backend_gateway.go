@@ -0,0 +1,82 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/krzko/restmigrate/pkg/rest"
+)
+
+// GatewayBackend stores the state on the target gateway through a client that
+// implements rest.StateStore.
+type GatewayBackend struct {
+	store rest.StateStore
+	name  string
+}
+
+// NewGatewayBackend returns a backend for apiClient, failing when the gateway
+// type cannot hold the state.
+func NewGatewayBackend(apiClient rest.Client, gatewayType string) (*GatewayBackend, error) {
+	store, ok := apiClient.(rest.StateStore)
+	if !ok {
+		return nil, fmt.Errorf("gateway type %s does not support storing state", gatewayType)
+	}
+	return &GatewayBackend{store: store, name: gatewayType}, nil
+}
+
+func (b *GatewayBackend) Read(ctx context.Context) ([]byte, error) {
+	data, err := b.store.ReadState(ctx)
+	if errors.Is(err, rest.ErrStateNotFound) {
+		return nil, ErrStateNotFound
+	}
+	return data, err
+}
+
+func (b *GatewayBackend) Write(ctx context.Context, data []byte) error {
+	return b.store.WriteState(ctx, data)
+}
+
+func (b *GatewayBackend) CreateLock(ctx context.Context, data []byte) error {
+	locks, err := b.locks()
+	if err != nil {
+		return err
+	}
+	err = locks.CreateLock(ctx, data)
+	if errors.Is(err, rest.ErrLockExists) {
+		return ErrLockExists
+	}
+	return err
+}
+
+func (b *GatewayBackend) ReadLock(ctx context.Context) ([]byte, error) {
+	locks, err := b.locks()
+	if err != nil {
+		return nil, err
+	}
+	data, err := locks.ReadLock(ctx)
+	if errors.Is(err, rest.ErrLockNotFound) {
+		return nil, ErrLockNotFound
+	}
+	return data, err
+}
+
+func (b *GatewayBackend) DeleteLock(ctx context.Context) error {
+	locks, err := b.locks()
+	if err != nil {
+		return err
+	}
+	return locks.DeleteLock(ctx)
+}
+
+func (b *GatewayBackend) locks() (rest.LockStore, error) {
+	locks, ok := b.store.(rest.LockStore)
+	if !ok {
+		return nil, fmt.Errorf("gateway type %s does not support locking", b.name)
+	}
+	return locks, nil
+}
+
+func (b *GatewayBackend) String() string {
+	return fmt.Sprintf("gateway (%s)", b.name)
+}
@@ -0,0 +1,150 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// HTTPBackend stores the state in a generic HTTP key-value endpoint. The state
+// is fetched with GET and stored with PUT on the same URL, a 404 response means
+// no state has been stored yet. The lock is kept under the same URL with a
+// .lock suffix and created with If-None-Match: *, so the endpoint must answer
+// 412 when the lock already exists.
+type HTTPBackend struct {
+	url        *url.URL
+	token      string
+	httpClient *http.Client
+}
+
+func newHTTPBackend(u *url.URL, token string, httpClient *http.Client) *HTTPBackend {
+	return &HTTPBackend{
+		url:        u,
+		token:      token,
+		httpClient: httpClient,
+	}
+}
+
+func (b *HTTPBackend) Read(ctx context.Context) ([]byte, error) {
+	resp, err := b.do(ctx, http.MethodGet, b.url, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrStateNotFound
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, fmt.Errorf("failed to read state: HTTP %d: %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+func (b *HTTPBackend) Write(ctx context.Context, data []byte) error {
+	resp, err := b.do(ctx, http.MethodPut, b.url, data, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to write state: HTTP %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (b *HTTPBackend) String() string {
+	return redactURL(b.url)
+}
+
+func (b *HTTPBackend) CreateLock(ctx context.Context, data []byte) error {
+	resp, err := b.do(ctx, http.MethodPut, b.lockURL(), data, map[string]string{"If-None-Match": "*"})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict:
+		return ErrLockExists
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to create lock: HTTP %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (b *HTTPBackend) ReadLock(ctx context.Context) ([]byte, error) {
+	resp, err := b.do(ctx, http.MethodGet, b.lockURL(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrLockNotFound
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, fmt.Errorf("failed to read lock: HTTP %d: %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+func (b *HTTPBackend) DeleteLock(ctx context.Context) error {
+	resp, err := b.do(ctx, http.MethodDelete, b.lockURL(), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to delete lock: HTTP %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (b *HTTPBackend) lockURL() *url.URL {
+	u := *b.url
+	u.Path += ".lock"
+	u.RawPath = ""
+	return &u
+}
+
+func (b *HTTPBackend) do(ctx context.Context, method string, u *url.URL, data []byte, headers map[string]string) (*http.Response, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+
+	return b.httpClient.Do(req)
+}
@@ -0,0 +1,192 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/krzko/restmigrate/internal/sigv4"
+)
+
+// S3Backend stores the state as an object in an S3 compatible store. The URL
+// has the form s3://bucket/key?region=us-east-1&endpoint=http://localhost:9000,
+// credentials are read from the standard AWS environment variables. The lock is
+// a sibling object with a .lock suffix, created with a conditional write.
+type S3Backend struct {
+	bucket     string
+	key        string
+	endpoint   *url.URL
+	signer     *sigv4.Signer
+	httpClient *http.Client
+}
+
+func newS3Backend(u *url.URL, httpClient *http.Client) (*S3Backend, error) {
+	bucket := u.Host
+	key := strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("s3 state URL must be s3://bucket/key")
+	}
+
+	query := u.Query()
+	region := query.Get("region")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	endpoint := query.Get("endpoint")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+
+	creds, err := sigv4.CredentialsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Backend{
+		bucket:   bucket,
+		key:      key,
+		endpoint: endpointURL,
+		signer: &sigv4.Signer{
+			Credentials: creds,
+			Region:      region,
+			Service:     "s3",
+		},
+		httpClient: httpClient,
+	}, nil
+}
+
+func (b *S3Backend) Read(ctx context.Context) ([]byte, error) {
+	resp, err := b.do(ctx, http.MethodGet, b.key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrStateNotFound
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, fmt.Errorf("failed to read state: HTTP %d: %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+func (b *S3Backend) Write(ctx context.Context, data []byte) error {
+	resp, err := b.do(ctx, http.MethodPut, b.key, data, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to write state: HTTP %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (b *S3Backend) String() string {
+	return fmt.Sprintf("s3://%s/%s", b.bucket, b.key)
+}
+
+func (b *S3Backend) CreateLock(ctx context.Context, data []byte) error {
+	resp, err := b.do(ctx, http.MethodPut, b.lockKey(), data, map[string]string{"If-None-Match": "*"})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict:
+		return ErrLockExists
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to create lock: HTTP %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (b *S3Backend) ReadLock(ctx context.Context) ([]byte, error) {
+	resp, err := b.do(ctx, http.MethodGet, b.lockKey(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrLockNotFound
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, fmt.Errorf("failed to read lock: HTTP %d: %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+func (b *S3Backend) DeleteLock(ctx context.Context) error {
+	resp, err := b.do(ctx, http.MethodDelete, b.lockKey(), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to delete lock: HTTP %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (b *S3Backend) lockKey() string {
+	return b.key + ".lock"
+}
+
+// do sends a signed path style request for key.
+func (b *S3Backend) do(ctx context.Context, method, key string, data []byte, headers map[string]string) (*http.Response, error) {
+	u := *b.endpoint
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + b.bucket + "/" + key
+
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	if err := b.signer.Sign(req, data); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	return b.httpClient.Do(req)
+}
@@ -0,0 +1,238 @@
+package migration
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lockingBackend is a state backend with locking support.
+type lockingBackend interface {
+	StateBackend
+	Locker
+}
+
+// kvServer is an in-memory key-value store answering GET, PUT and DELETE. A
+// PUT with If-None-Match: * fails with 412 when the key already exists.
+type kvServer struct {
+	mu       sync.Mutex
+	values   map[string][]byte
+	requests []*http.Request
+}
+
+func newKVServer(t *testing.T) (*kvServer, *httptest.Server) {
+	kv := &kvServer{values: make(map[string][]byte)}
+	srv := httptest.NewServer(kv)
+	t.Cleanup(srv.Close)
+	return kv, srv
+}
+
+func (s *kvServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+
+	key := r.URL.Path
+	switch r.Method {
+	case http.MethodGet:
+		value, ok := s.values[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(value)
+	case http.MethodPut:
+		if _, ok := s.values[key]; ok && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		s.values[key] = body
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if _, ok := s.values[key]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(s.values, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *kvServer) lastRequest() *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+// testBackend exercises the state and lock operations of backend.
+func testBackend(t *testing.T, backend lockingBackend) {
+	ctx := context.Background()
+
+	if _, err := backend.Read(ctx); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("Read of empty backend: got %v, want ErrStateNotFound", err)
+	}
+	for _, state := range []string{`{"version":"1"}`, `{"version":"2"}`} {
+		if err := backend.Write(ctx, []byte(state)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		data, err := backend.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		if string(data) != state {
+			t.Errorf("Read = %s, want %s", data, state)
+		}
+	}
+
+	if _, err := backend.ReadLock(ctx); !errors.Is(err, ErrLockNotFound) {
+		t.Fatalf("ReadLock without lock: got %v, want ErrLockNotFound", err)
+	}
+	if err := backend.CreateLock(ctx, []byte(`{"id":"a"}`)); err != nil {
+		t.Fatalf("CreateLock: %v", err)
+	}
+	if err := backend.CreateLock(ctx, []byte(`{"id":"b"}`)); !errors.Is(err, ErrLockExists) {
+		t.Fatalf("second CreateLock: got %v, want ErrLockExists", err)
+	}
+	data, err := backend.ReadLock(ctx)
+	if err != nil {
+		t.Fatalf("ReadLock: %v", err)
+	}
+	if string(data) != `{"id":"a"}` {
+		t.Errorf("ReadLock = %s, want the first lock", data)
+	}
+	if err := backend.DeleteLock(ctx); err != nil {
+		t.Fatalf("DeleteLock: %v", err)
+	}
+	if err := backend.DeleteLock(ctx); err != nil {
+		t.Fatalf("DeleteLock without lock: %v", err)
+	}
+	if err := backend.CreateLock(ctx, []byte(`{"id":"c"}`)); err != nil {
+		t.Fatalf("CreateLock after delete: %v", err)
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	backend, err := NewStateBackend("", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBackend(t, backend.(*FileBackend))
+}
+
+func TestFileBackendURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	backend, err := NewStateBackend("file://"+path, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := backend.String(); got != path {
+		t.Errorf("path = %s, want %s", got, path)
+	}
+}
+
+func TestHTTPBackend(t *testing.T) {
+	kv, srv := newKVServer(t)
+	t.Setenv("RESTMIGRATE_STATE_TOKEN", "secret")
+
+	backend, err := NewStateBackend(srv.URL+"/states/prod?ignored=1", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBackend(t, backend.(*HTTPBackend))
+
+	req := kv.lastRequest()
+	if req.URL.Path != "/states/prod.lock" {
+		t.Errorf("lock path = %s", req.URL.Path)
+	}
+	if got := req.Header.Get("If-None-Match"); got != "*" {
+		t.Errorf("If-None-Match = %q, want *", got)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := backend.String(); strings.Contains(got, "ignored") {
+		t.Errorf("String() = %s, want the query redacted", got)
+	}
+}
+
+func TestHTTPBackendTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(&kvServer{values: make(map[string][]byte)})
+	defer srv.Close()
+
+	// Without the test server's CA the connection fails.
+	backend, err := NewStateBackend(srv.URL+"/states/prod", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Read(context.Background()); err == nil {
+		t.Fatal("read succeeded without trusting the server certificate")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	backend, err = NewStateBackend(srv.URL+"/states/prod", "", &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Read(context.Background()); !errors.Is(err, ErrStateNotFound) {
+		t.Errorf("got %v, want ErrStateNotFound", err)
+	}
+}
+
+func TestS3Backend(t *testing.T) {
+	kv, srv := newKVServer(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	backend, err := NewStateBackend("s3://bucket/envs/prod.json?region=eu-west-1&endpoint="+url.QueryEscape(srv.URL), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBackend(t, backend.(*S3Backend))
+
+	req := kv.lastRequest()
+	if req.URL.Path != "/bucket/envs/prod.json.lock" {
+		t.Errorf("lock path = %s", req.URL.Path)
+	}
+	if got := req.Header.Get("If-None-Match"); got != "*" {
+		t.Errorf("If-None-Match = %q, want *", got)
+	}
+	if got := req.Header.Get("Authorization"); !strings.HasPrefix(got, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(got, "/eu-west-1/s3/aws4_request") {
+		t.Errorf("Authorization = %q", got)
+	}
+}
+
+func TestS3BackendURL(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	for _, stateURL := range []string{"s3://bucket", "s3:///key"} {
+		if _, err := NewStateBackend(stateURL, "", nil); err == nil {
+			t.Errorf("%s: expected an error", stateURL)
+		}
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	if _, err := NewStateBackend("s3://bucket/key", "", nil); err == nil {
+		t.Error("expected an error without credentials")
+	}
+}
+
+func TestNewStateBackendUnsupported(t *testing.T) {
+	if _, err := NewStateBackend("ftp://host/state", "", nil); err == nil {
+		t.Error("expected an error for an unsupported scheme")
+	}
+}
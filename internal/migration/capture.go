@@ -0,0 +1,189 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// referencePattern matches ${name} references to captured values.
+var referencePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.-]*)\}`)
+
+// Resolve returns a copy of the step with ${name} references in its path,
+// headers and body replaced by captured values. A string made of a single
+// reference takes the type of the captured value. Unless allowMissing is set,
+// references to unknown names are an error; otherwise they are left as is.
+func (s Step) Resolve(values map[string]interface{}, allowMissing bool) (Step, error) {
+	r := resolver{values: values, allowMissing: allowMissing}
+
+	resolved := s
+	resolved.Path = r.interpolate(s.Path)
+	if s.Headers != nil {
+		resolved.Headers = make(map[string]string, len(s.Headers))
+		for key, value := range s.Headers {
+			resolved.Headers[key] = r.interpolate(value)
+		}
+	}
+	resolved.Body = r.resolveValue(s.Body)
+
+	if len(r.missing) > 0 {
+		return resolved, fmt.Errorf("undefined capture(s): %s", strings.Join(r.sortedMissing(), ", "))
+	}
+	return resolved, nil
+}
+
+// CaptureNames returns the names of the values captured by the steps.
+func (a Actions) CaptureNames() []string {
+	var names []string
+	for _, step := range a.Steps {
+		for name := range step.Capture {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExtractCapture looks up path in a JSON response body. Paths are dot
+// separated with optional [n] list indexes, e.g. data.routes[0].id, and may
+// start with $. as in JSONPath.
+func ExtractCapture(body []byte, path string) (interface{}, error) {
+	var current interface{}
+	if err := json.Unmarshal(body, &current); err != nil {
+		return nil, fmt.Errorf("response is not JSON: %w", err)
+	}
+
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return current, nil
+	}
+
+	for _, segment := range strings.Split(path, ".") {
+		name, indexes, err := splitIndexes(segment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid capture path %q: %w", path, err)
+		}
+
+		if name != "" {
+			object, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("capture path %q: %s is not an object", path, name)
+			}
+			current, ok = object[name]
+			if !ok {
+				return nil, fmt.Errorf("capture path %q: field %s not found", path, name)
+			}
+		}
+
+		for _, index := range indexes {
+			list, ok := current.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("capture path %q: %s is not a list", path, segment)
+			}
+			if index < 0 || index >= len(list) {
+				return nil, fmt.Errorf("capture path %q: index %d out of range", path, index)
+			}
+			current = list[index]
+		}
+	}
+
+	return current, nil
+}
+
+func splitIndexes(segment string) (string, []int, error) {
+	open := strings.Index(segment, "[")
+	if open < 0 {
+		return segment, nil, nil
+	}
+
+	name := segment[:open]
+	var indexes []int
+	rest := segment[open:]
+	for rest != "" {
+		end := strings.Index(rest, "]")
+		if !strings.HasPrefix(rest, "[") || end < 0 {
+			return "", nil, fmt.Errorf("malformed index in %s", segment)
+		}
+		index, err := strconv.Atoi(rest[1:end])
+		if err != nil {
+			return "", nil, fmt.Errorf("malformed index in %s", segment)
+		}
+		indexes = append(indexes, index)
+		rest = rest[end+1:]
+	}
+	return name, indexes, nil
+}
+
+type resolver struct {
+	values       map[string]interface{}
+	allowMissing bool
+	missing      map[string]bool
+}
+
+func (r *resolver) resolveValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case string:
+		if m := referencePattern.FindStringSubmatch(value); m != nil && m[0] == value {
+			if captured, ok := r.lookup(m[1]); ok {
+				return captured
+			}
+			return value
+		}
+		return r.interpolate(value)
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			resolved[key] = r.resolveValue(item)
+		}
+		return resolved
+	case []interface{}:
+		resolved := make([]interface{}, len(value))
+		for i, item := range value {
+			resolved[i] = r.resolveValue(item)
+		}
+		return resolved
+	default:
+		return v
+	}
+}
+
+func (r *resolver) interpolate(s string) string {
+	return referencePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := referencePattern.FindStringSubmatch(ref)[1]
+		captured, ok := r.lookup(name)
+		if !ok {
+			return ref
+		}
+		if str, ok := captured.(string); ok {
+			return str
+		}
+		data, err := json.Marshal(captured)
+		if err != nil {
+			return fmt.Sprint(captured)
+		}
+		return string(data)
+	})
+}
+
+func (r *resolver) lookup(name string) (interface{}, bool) {
+	value, ok := r.values[name]
+	if !ok && !r.allowMissing {
+		if r.missing == nil {
+			r.missing = make(map[string]bool)
+		}
+		r.missing[name] = true
+	}
+	return value, ok
+}
+
+func (r *resolver) sortedMissing() []string {
+	names := make([]string, 0, len(r.missing))
+	for name := range r.missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,170 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractCapture(t *testing.T) {
+	body := []byte(`{
+		"id": "svc-1",
+		"port": 8080,
+		"data": {"routes": [{"id": "r-1", "hosts": ["a.example.com", "b.example.com"]}]},
+		"matrix": [[1, 2], [3, 4]]
+	}`)
+
+	tests := []struct {
+		path    string
+		want    interface{}
+		wantErr bool
+	}{
+		{path: "id", want: "svc-1"},
+		{path: "$.id", want: "svc-1"},
+		{path: "port", want: float64(8080)},
+		{path: "data.routes[0].id", want: "r-1"},
+		{path: "$.data.routes[0].hosts[1]", want: "b.example.com"},
+		{path: "matrix[1][0]", want: float64(3)},
+		{path: "data.routes[0]", want: map[string]interface{}{
+			"id":    "r-1",
+			"hosts": []interface{}{"a.example.com", "b.example.com"},
+		}},
+		{path: "missing", wantErr: true},
+		{path: "id.nested", wantErr: true},
+		{path: "data.routes[1]", wantErr: true},
+		{path: "data.routes[-1]", wantErr: true},
+		{path: "data[0]", wantErr: true},
+		{path: "data.routes[x]", wantErr: true},
+		{path: "data.routes[0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ExtractCapture(body, tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractCaptureNotJSON(t *testing.T) {
+	if _, err := ExtractCapture([]byte("created"), "id"); err == nil {
+		t.Error("expected an error for a non JSON body")
+	}
+}
+
+func TestStepResolve(t *testing.T) {
+	values := map[string]interface{}{
+		"service_id": "svc-1",
+		"port":       float64(8080),
+		"hosts":      []interface{}{"a.example.com"},
+		"route.id":   "r-1",
+	}
+
+	tests := []struct {
+		name         string
+		step         Step
+		allowMissing bool
+		want         Step
+		wantErr      bool
+	}{
+		{
+			name: "path and headers are interpolated",
+			step: Step{
+				Method:  "PATCH",
+				Path:    "/services/${service_id}/routes/${route.id}",
+				Headers: map[string]string{"X-Service": "${service_id}", "X-Port": "port ${port}"},
+			},
+			want: Step{
+				Method:  "PATCH",
+				Path:    "/services/svc-1/routes/r-1",
+				Headers: map[string]string{"X-Service": "svc-1", "X-Port": "port 8080"},
+			},
+		},
+		{
+			name: "a whole string reference keeps the captured type",
+			step: Step{
+				Method: "POST",
+				Path:   "/routes",
+				Body: map[string]interface{}{
+					"service": map[string]interface{}{"id": "${service_id}"},
+					"port":    "${port}",
+					"hosts":   "${hosts}",
+					"paths":   []interface{}{"/${service_id}"},
+					"name":    "route-${port}",
+					"enabled": true,
+				},
+			},
+			want: Step{
+				Method: "POST",
+				Path:   "/routes",
+				Body: map[string]interface{}{
+					"service": map[string]interface{}{"id": "svc-1"},
+					"port":    float64(8080),
+					"hosts":   []interface{}{"a.example.com"},
+					"paths":   []interface{}{"/svc-1"},
+					"name":    "route-8080",
+					"enabled": true,
+				},
+			},
+		},
+		{
+			name: "text without references is unchanged",
+			step: Step{Method: "GET", Path: "/services/$id/{name}"},
+			want: Step{Method: "GET", Path: "/services/$id/{name}"},
+		},
+		{
+			name:    "missing references are an error",
+			step:    Step{Method: "GET", Path: "/services/${unknown}", Body: "${other}"},
+			want:    Step{Method: "GET", Path: "/services/${unknown}", Body: "${other}"},
+			wantErr: true,
+		},
+		{
+			name:         "missing references are kept when allowed",
+			step:         Step{Method: "GET", Path: "/services/${unknown}", Body: "${other}"},
+			allowMissing: true,
+			want:         Step{Method: "GET", Path: "/services/${unknown}", Body: "${other}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.step.Resolve(values, tt.allowMissing)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStepResolveReportsMissingNames(t *testing.T) {
+	step := Step{Method: "GET", Path: "/${b}/${a}/${b}"}
+	_, err := step.Resolve(nil, false)
+	if err == nil || err.Error() != "undefined capture(s): a, b" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestCaptureNames(t *testing.T) {
+	actions := Actions{Steps: []Step{
+		{Method: "POST", Path: "/services", Capture: map[string]string{"service_id": "id"}},
+		{Method: "GET", Path: "/"},
+		{Method: "POST", Path: "/routes", Capture: map[string]string{"route_id": "id", "hosts": "hosts"}},
+	}}
+	want := []string{"hosts", "route_id", "service_id"}
+	if got := actions.CaptureNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,227 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Resource is the state a resource of the target API is expected to be in
+// once the applied migrations have run. Body only holds the fields set by the
+// migrations, as gateways add defaults and generated fields of their own.
+type Resource struct {
+	Path      string
+	Body      interface{}
+	Deleted   bool
+	Migration string
+}
+
+// ExpectedResources replays the up steps of migrations in order and returns
+// the resources they leave behind, ordered by first change. PUT replaces a
+// resource, PATCH merges into it and DELETE removes it. A POST creates a
+// resource below its path, located by a captured id or by the name or id in
+// the body; steps whose resource cannot be located are returned as warnings.
+func ExpectedResources(migrations []Migration, captures map[string]interface{}) ([]Resource, []string) {
+	var resources []*Resource
+	byPath := make(map[string]*Resource)
+	var warnings []string
+
+	for _, m := range migrations {
+		for i, step := range m.Up.Steps {
+			if step.Method == http.MethodGet || step.Method == http.MethodHead {
+				continue
+			}
+
+			resolved, err := step.Resolve(captures, false)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s step %d (%s %s): %v", m.Name, i, step.Method, step.Path, err))
+				continue
+			}
+			body, err := normalize(resolved.Body)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s step %d (%s %s): %v", m.Name, i, step.Method, step.Path, err))
+				continue
+			}
+
+			path := resolved.Path
+			if step.Method == http.MethodPost {
+				path = createdPath(resolved, body, captures)
+				if path == "" {
+					warnings = append(warnings, fmt.Sprintf("%s step %d (%s %s): cannot locate the created resource, capture its id", m.Name, i, step.Method, step.Path))
+					continue
+				}
+			}
+
+			resource, ok := byPath[path]
+			if !ok {
+				resource = &Resource{Path: path}
+				byPath[path] = resource
+				resources = append(resources, resource)
+			}
+			resource.Migration = m.Name
+
+			switch step.Method {
+			case http.MethodDelete:
+				resource.Body = nil
+				resource.Deleted = true
+			case http.MethodPatch:
+				resource.Body = mergePatch(resource.Body, body)
+				resource.Deleted = false
+			default:
+				resource.Body = body
+				resource.Deleted = false
+			}
+		}
+	}
+
+	expected := make([]Resource, 0, len(resources))
+	for _, r := range resources {
+		expected = append(expected, *r)
+	}
+	return expected, warnings
+}
+
+// createdPath returns the path of the resource created by a POST step.
+func createdPath(step Step, body interface{}, captures map[string]interface{}) string {
+	base := strings.TrimRight(step.Path, "/")
+
+	var names []string
+	for name, path := range step.Capture {
+		if strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".") == "id" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if id, ok := captures[name]; ok {
+			return fmt.Sprintf("%s/%v", base, id)
+		}
+	}
+
+	object, ok := body.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	for _, key := range []string{"name", "id"} {
+		switch value := object[key].(type) {
+		case string:
+			if value != "" {
+				return base + "/" + value
+			}
+		case float64:
+			return fmt.Sprintf("%s/%v", base, value)
+		}
+	}
+	return ""
+}
+
+// mergePatch applies patch to target as a JSON merge patch: objects are merged
+// recursively, null removes a field and any other value replaces it.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	merged := make(map[string]interface{}, len(targetObject)+len(patchObject))
+	for key, value := range targetObject {
+		merged[key] = value
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = mergePatch(merged[key], value)
+	}
+	return merged
+}
+
+// normalize round trips v through JSON so it compares equal to a decoded
+// response, e.g. all numbers become float64.
+func normalize(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode body: %w", err)
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, fmt.Errorf("failed to decode body: %w", err)
+	}
+	return normalized, nil
+}
+
+// Difference is a field whose live value does not match the expected one.
+// Live is nil and Missing is set when the field is absent.
+type Difference struct {
+	Field    string
+	Expected interface{}
+	Live     interface{}
+	Missing  bool
+}
+
+// Diff compares the fields of expected with live, a decoded JSON response.
+// Fields that only exist in live are ignored, lists are compared element by
+// element and must have the same length.
+func Diff(expected, live interface{}) []Difference {
+	var diffs []Difference
+	diffValue("", expected, live, true, &diffs)
+	return diffs
+}
+
+func diffValue(field string, expected, live interface{}, present bool, diffs *[]Difference) {
+	if !present {
+		if expected != nil {
+			*diffs = append(*diffs, Difference{Field: field, Expected: expected, Missing: true})
+		}
+		return
+	}
+
+	switch expected := expected.(type) {
+	case map[string]interface{}:
+		liveObject, ok := live.(map[string]interface{})
+		if !ok {
+			*diffs = append(*diffs, Difference{Field: field, Expected: expected, Live: live})
+			return
+		}
+		keys := make([]string, 0, len(expected))
+		for key := range expected {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, ok := liveObject[key]
+			diffValue(joinField(field, key), expected[key], value, ok, diffs)
+		}
+	case []interface{}:
+		liveList, ok := live.([]interface{})
+		if !ok || len(liveList) != len(expected) {
+			*diffs = append(*diffs, Difference{Field: field, Expected: expected, Live: live})
+			return
+		}
+		for i := range expected {
+			diffValue(fmt.Sprintf("%s[%d]", field, i), expected[i], liveList[i], true, diffs)
+		}
+	default:
+		if !reflect.DeepEqual(expected, live) {
+			*diffs = append(*diffs, Difference{Field: field, Expected: expected, Live: live})
+		}
+	}
+}
+
+func joinField(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
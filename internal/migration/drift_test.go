@@ -0,0 +1,116 @@
+package migration
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, data string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{name: "add field", target: `{"a": 1}`, patch: `{"b": 2}`, want: `{"a": 1, "b": 2}`},
+		{name: "replace field", target: `{"a": 1}`, patch: `{"a": 2}`, want: `{"a": 2}`},
+		{name: "null removes", target: `{"a": 1, "b": 2}`, patch: `{"a": null}`, want: `{"b": 2}`},
+		{name: "nested merge", target: `{"plugins": {"a": {"x": 1}, "b": {}}}`, patch: `{"plugins": {"a": {"y": 2}}}`, want: `{"plugins": {"a": {"x": 1, "y": 2}, "b": {}}}`},
+		{name: "list replaces", target: `{"hosts": ["a", "b"]}`, patch: `{"hosts": ["c"]}`, want: `{"hosts": ["c"]}`},
+		{name: "object replaces scalar", target: `{"a": 1}`, patch: `{"a": {"b": 1}}`, want: `{"a": {"b": 1}}`},
+		{name: "no target", target: `null`, patch: `{"a": 1}`, want: `{"a": 1}`},
+		{name: "non-object patch", target: `{"a": 1}`, patch: `[1]`, want: `[1]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := decodeJSON(t, tt.target)
+			got := mergePatch(target, decodeJSON(t, tt.patch))
+			if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if !reflect.DeepEqual(target, decodeJSON(t, tt.target)) {
+				t.Errorf("target was modified: %v", target)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		live     string
+		want     []Difference
+	}{
+		{name: "equal", expected: `{"a": 1, "b": {"c": [1, 2]}}`, live: `{"a": 1, "b": {"c": [1, 2]}}`},
+		{name: "live only fields ignored", expected: `{"a": 1}`, live: `{"a": 1, "id": "x", "create_time": 1}`},
+		{name: "changed", expected: `{"a": 1, "b": "x"}`, live: `{"a": 2, "b": "x"}`, want: []Difference{{Field: "a", Expected: 1.0, Live: 2.0}}},
+		{name: "missing", expected: `{"a": 1, "b": {"c": true}}`, live: `{"b": {}}`, want: []Difference{
+			{Field: "a", Expected: 1.0, Missing: true},
+			{Field: "b.c", Expected: true, Missing: true},
+		}},
+		{name: "expected null may be missing", expected: `{"a": null}`, live: `{}`},
+		{name: "list element", expected: `{"nodes": [{"port": 80}]}`, live: `{"nodes": [{"port": 81}]}`, want: []Difference{{Field: "nodes[0].port", Expected: 80.0, Live: 81.0}}},
+		{name: "list length", expected: `{"hosts": ["a"]}`, live: `{"hosts": ["a", "b"]}`, want: []Difference{{Field: "hosts", Expected: []interface{}{"a"}, Live: []interface{}{"a", "b"}}}},
+		{name: "type", expected: `{"a": {"b": 1}}`, live: `{"a": "b"}`, want: []Difference{{Field: "a", Expected: map[string]interface{}{"b": 1.0}, Live: "b"}}},
+		{name: "sorted fields", expected: `{"z": 1, "a": 1}`, live: `{"z": 2, "a": 2}`, want: []Difference{
+			{Field: "a", Expected: 1.0, Live: 2.0},
+			{Field: "z", Expected: 1.0, Live: 2.0},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Diff(decodeJSON(t, tt.expected), decodeJSON(t, tt.live))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectedResources(t *testing.T) {
+	migrations := []Migration{
+		{Name: "create", Up: Actions{Steps: []Step{
+			{Method: "PUT", Path: "/upstreams/1", Body: map[string]interface{}{"type": "roundrobin", "retries": 3}},
+			{Method: "POST", Path: "/services/", Body: map[string]interface{}{"name": "example", "port": 80}},
+			{Method: "POST", Path: "/routes", Body: map[string]interface{}{"paths": []string{"/"}}, Capture: map[string]string{"route_id": "$.id"}},
+			{Method: "POST", Path: "/consumers", Body: map[string]interface{}{"username": "anonymous"}},
+			{Method: "GET", Path: "/status"},
+		}}},
+		{Name: "update", Up: Actions{Steps: []Step{
+			{Method: "PATCH", Path: "/upstreams/1", Body: map[string]interface{}{"retries": 10, "type": nil}},
+			{Method: "DELETE", Path: "/services/example"},
+			{Method: "PUT", Path: "/routes/${route_id}/plugins", Body: map[string]interface{}{"cors": map[string]interface{}{}}},
+			{Method: "PUT", Path: "/ssls/${ssl_id}", Body: map[string]interface{}{}},
+		}}},
+	}
+	captures := map[string]interface{}{"route_id": "r1"}
+
+	got, warnings := ExpectedResources(migrations, captures)
+	want := []Resource{
+		{Path: "/upstreams/1", Body: map[string]interface{}{"retries": 10.0}, Migration: "update"},
+		{Path: "/services/example", Deleted: true, Migration: "update"},
+		{Path: "/routes/r1", Body: map[string]interface{}{"paths": []interface{}{"/"}}, Migration: "create"},
+		{Path: "/routes/r1/plugins", Body: map[string]interface{}{"cors": map[string]interface{}{}}, Migration: "update"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+	// The consumer cannot be located and ssl_id was never captured.
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "POST /consumers") || !strings.Contains(warnings[1], "ssl_id") {
+		t.Errorf("got warnings %q", warnings)
+	}
+}
@@ -0,0 +1,222 @@
+package migration
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/krzko/restmigrate/internal/telemetry"
+)
+
+var (
+	// ErrLockExists is returned by Locker.CreateLock when the lock is held.
+	ErrLockExists = errors.New("lock already exists")
+	// ErrLockNotFound is returned by Locker.ReadLock when no lock is held.
+	ErrLockNotFound = errors.New("lock not found")
+)
+
+// DefaultLockTTL is how long a lock is honoured before another run may take it
+// over, unless the run asks for a longer one.
+const DefaultLockTTL = 15 * time.Minute
+
+const lockRetryInterval = time.Second
+
+// Locker is implemented by state backends that support advisory locking.
+// CreateLock must fail with ErrLockExists when a lock is already present.
+type Locker interface {
+	CreateLock(ctx context.Context, data []byte) error
+	ReadLock(ctx context.Context) ([]byte, error)
+	DeleteLock(ctx context.Context) error
+}
+
+type LockInfo struct {
+	ID        string    `json:"id"`
+	Operation string    `json:"operation"`
+	User      string    `json:"user"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+}
+
+func (i LockInfo) expired(now time.Time) bool {
+	return !i.Expires.IsZero() && now.After(i.Expires)
+}
+
+// Lock is an acquired advisory lock on a state backend.
+type Lock struct {
+	Info   LockInfo
+	locker Locker
+}
+
+// AcquireLock takes the lock on backend for ttl, retrying until timeout when
+// another run holds it. Expired locks are taken over. Backends without locking
+// support return a lock that does nothing.
+func AcquireLock(ctx context.Context, backend StateBackend, operation string, timeout, ttl time.Duration) (*Lock, error) {
+	ctx, span := telemetry.StartSpan(ctx, "AcquireLock")
+	defer span.End()
+
+	locker, ok := backend.(Locker)
+	if !ok {
+		logger.Warn("State backend does not support locking", "backend", backend)
+		return &Lock{}, nil
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	}
+	info, err := newLockInfo(operation, ttl)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := locker.CreateLock(ctx, data)
+		if err == nil {
+			logger.Debug("Acquired state lock", "id", info.ID, "backend", backend)
+			return &Lock{Info: info, locker: locker}, nil
+		}
+		if !errors.Is(err, ErrLockExists) {
+			return nil, fmt.Errorf("failed to acquire lock: %w", err)
+		}
+
+		holder, err := readLockInfo(ctx, locker)
+		if errors.Is(err, ErrLockNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read lock: %w", err)
+		}
+
+		if holder.expired(time.Now()) {
+			logger.Warn("Taking over expired state lock", "id", holder.ID, "user", holder.User, "host", holder.Host, "expired", holder.Expires)
+			if err := deleteExpiredLock(ctx, locker, holder.ID); err != nil {
+				return nil, fmt.Errorf("failed to remove expired lock: %w", err)
+			}
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("state is locked by %s@%s (pid %d, %s since %s, id %s), use force-unlock to remove a stale lock",
+				holder.User, holder.Host, holder.PID, holder.Operation, holder.Created.Format(time.RFC3339), holder.ID)
+		}
+
+		logger.Info("Waiting for state lock", "user", holder.User, "host", holder.Host, "operation", holder.Operation)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// Release removes the lock if it is still held by this run.
+func (l *Lock) Release(ctx context.Context) error {
+	if l.locker == nil {
+		return nil
+	}
+
+	holder, err := readLockInfo(ctx, l.locker)
+	if errors.Is(err, ErrLockNotFound) {
+		logger.Warn("State lock was already removed", "id", l.Info.ID)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read lock: %w", err)
+	}
+	if holder.ID != l.Info.ID {
+		logger.Warn("State lock is held by another run, leaving it in place", "id", holder.ID)
+		return nil
+	}
+
+	logger.Debug("Releasing state lock", "id", l.Info.ID)
+	return l.locker.DeleteLock(ctx)
+}
+
+// ForceUnlock removes the lock on backend regardless of who holds it and
+// returns the removed lock.
+func ForceUnlock(ctx context.Context, backend StateBackend) (*LockInfo, error) {
+	ctx, span := telemetry.StartSpan(ctx, "ForceUnlock")
+	defer span.End()
+
+	locker, ok := backend.(Locker)
+	if !ok {
+		return nil, fmt.Errorf("state backend %s does not support locking", backend)
+	}
+
+	holder, err := readLockInfo(ctx, locker)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := locker.DeleteLock(ctx); err != nil {
+		return nil, fmt.Errorf("failed to remove lock: %w", err)
+	}
+	return holder, nil
+}
+
+// deleteExpiredLock removes the lock if it is still the expired lock id. Another
+// run may have taken the expired lock over since it was read, its new lock is
+// left in place and CreateLock fails again.
+func deleteExpiredLock(ctx context.Context, locker Locker, id string) error {
+	holder, err := readLockInfo(ctx, locker)
+	if errors.Is(err, ErrLockNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if holder.ID != id {
+		logger.Debug("Expired state lock was already taken over", "id", holder.ID)
+		return nil
+	}
+	return locker.DeleteLock(ctx)
+}
+
+func readLockInfo(ctx context.Context, locker Locker) (*LockInfo, error) {
+	data, err := locker.ReadLock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var info LockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("invalid lock: %w", err)
+	}
+	return &info, nil
+}
+
+func newLockInfo(operation string, ttl time.Duration) (LockInfo, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return LockInfo{}, fmt.Errorf("failed to generate lock id: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	now := time.Now().UTC()
+	return LockInfo{
+		ID:        hex.EncodeToString(id),
+		Operation: operation,
+		User:      currentUser(),
+		Host:      host,
+		PID:       os.Getpid(),
+		Created:   now,
+		Expires:   now.Add(ttl),
+	}, nil
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,74 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func writeLock(t *testing.T, backend *FileBackend, info LockInfo) {
+	t.Helper()
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.CreateLock(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireLockTakesOverExpiredLock(t *testing.T) {
+	ctx := context.Background()
+	backend := &FileBackend{path: t.TempDir() + "/state.json"}
+	writeLock(t, backend, LockInfo{ID: "stale", Expires: time.Now().Add(-time.Minute)})
+
+	lock, err := AcquireLock(ctx, backend, "up", 0, time.Hour)
+	if err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+	holder, err := readLockInfo(ctx, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holder.ID != lock.Info.ID {
+		t.Errorf("lock held by %s, want %s", holder.ID, lock.Info.ID)
+	}
+	if ttl := holder.Expires.Sub(holder.Created); ttl != time.Hour {
+		t.Errorf("lock TTL = %s, want 1h", ttl)
+	}
+
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, err := backend.ReadLock(ctx); err != ErrLockNotFound {
+		t.Errorf("ReadLock after Release: got %v, want ErrLockNotFound", err)
+	}
+}
+
+func TestAcquireLockHeld(t *testing.T) {
+	backend := &FileBackend{path: t.TempDir() + "/state.json"}
+	writeLock(t, backend, LockInfo{ID: "other", Expires: time.Now().Add(time.Hour)})
+
+	if _, err := AcquireLock(context.Background(), backend, "up", 0, 0); err == nil {
+		t.Fatal("expected an error while the lock is held")
+	}
+}
+
+func TestDeleteExpiredLockKeepsNewLock(t *testing.T) {
+	ctx := context.Background()
+	backend := &FileBackend{path: t.TempDir() + "/state.json"}
+	// Another run took the expired lock over after it was read.
+	writeLock(t, backend, LockInfo{ID: "new", Expires: time.Now().Add(time.Hour)})
+
+	if err := deleteExpiredLock(ctx, backend, "stale"); err != nil {
+		t.Fatalf("deleteExpiredLock: %v", err)
+	}
+	holder, err := readLockInfo(ctx, backend)
+	if err != nil {
+		t.Fatalf("lock was removed: %v", err)
+	}
+	if holder.ID != "new" {
+		t.Errorf("lock held by %s, want new", holder.ID)
+	}
+}
@@ -0,0 +1,16 @@
+package migration
+
+import (
+	"os"
+	"testing"
+
+	"github.com/krzko/restmigrate/internal/telemetry"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("OTEL_SDK_ENABLED", "false")
+	if _, err := telemetry.InitTracer("restmigrate-test", nil); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
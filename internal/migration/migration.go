@@ -2,7 +2,11 @@ package migration
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"time"
@@ -13,10 +17,16 @@ import (
 )
 
 type Migration struct {
-	Timestamp int64                  `json:"timestamp"`
-	Name      string                 `json:"name"`
-	Up        map[string]interface{} `json:"up"`
-	Down      map[string]interface{} `json:"down"`
+	Timestamp int64   `json:"timestamp"`
+	Name      string  `json:"name"`
+	Up        Actions `json:"up"`
+	Down      Actions `json:"down"`
+	// Verify holds the checks run once the migration is applied. They are
+	// not part of the checksum, as they do not change the target API.
+	Verify []Check `json:"-"`
+	// Source is the up and down blocks as written, before variables are
+	// injected. When set it is hashed by Checksum instead of Up and Down.
+	Source []byte `json:"-"`
 }
 
 func CreateMigration(ctx context.Context, c *cli.Context) error {
@@ -37,12 +47,13 @@ func CreateMigration(ctx context.Context, c *cli.Context) error {
     {
         timestamp: %d
         name:      "%s"
-        up: {
-            // Define your up migration here
-        }
-        down: {
-            // Define your down migration here
-        }
+        up: steps: [
+            // Define your up steps here, e.g.
+            // {method: "POST", path: "/services", body: {}}
+        ]
+        down: steps: [
+            // Define your down steps here, in reverse order
+        ]
     }
 ]
 `, timestamp, name)
@@ -57,3 +68,42 @@ func CreateMigration(ctx context.Context, c *cli.Context) error {
 	logger.Info("Created migration", "file", filePath)
 	return nil
 }
+
+// Validate checks the rules that span the up and down blocks. A down block
+// declared as "auto" needs every resource changed by up to have a known path
+// before it is sent, which rules out POST.
+func (m Migration) Validate() error {
+	if m.Up.Auto {
+		return fmt.Errorf("up cannot be \"auto\"")
+	}
+	if !m.Down.Auto {
+		return nil
+	}
+	for i, step := range m.Up.Steps {
+		if step.Method == http.MethodPost {
+			return fmt.Errorf("down \"auto\" cannot revert up step %d (POST %s), create the resource with PUT to its path instead", i, step.Path)
+		}
+	}
+	return nil
+}
+
+// Checksum returns a hash of the normalised up and down actions, used to
+// detect edits to migrations that have already been applied. Migrations loaded
+// from a file hash their source, so the checksum does not change with the
+// injected variables and does not depend on secret values.
+func (m Migration) Checksum() (string, error) {
+	data := m.Source
+	if data == nil {
+		var err error
+		data, err = json.Marshal(struct {
+			Up   Actions `json:"up"`
+			Down Actions `json:"down"`
+		}{m.Up, m.Down})
+		if err != nil {
+			return "", fmt.Errorf("failed to normalise migration %s: %w", m.Name, err)
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,57 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrationValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       Migration
+		wantErr string
+	}{
+		{
+			name: "declared down",
+			m: Migration{
+				Up:   Actions{Steps: []Step{{Method: "POST", Path: "/services"}}},
+				Down: Actions{Steps: []Step{{Method: "DELETE", Path: "/services/a"}}},
+			},
+		},
+		{
+			name: "auto down",
+			m: Migration{
+				Up:   Actions{Steps: []Step{{Method: "PUT", Path: "/services/a"}, {Method: "PATCH", Path: "/routes/r"}}},
+				Down: Actions{Auto: true},
+			},
+		},
+		{
+			name: "auto down after POST",
+			m: Migration{
+				Up:   Actions{Steps: []Step{{Method: "PUT", Path: "/services/a"}, {Method: "POST", Path: "/routes"}}},
+				Down: Actions{Auto: true},
+			},
+			wantErr: "cannot revert up step 1 (POST /routes)",
+		},
+		{
+			name:    "auto up",
+			m:       Migration{Up: Actions{Auto: true}},
+			wantErr: "up cannot be \"auto\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.m.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
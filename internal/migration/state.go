@@ -3,80 +3,117 @@ package migration
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"os"
-	"path/filepath"
 	"sort"
+	"time"
 
 	"github.com/krzko/restmigrate/internal/logger"
 	"github.com/krzko/restmigrate/internal/telemetry"
 )
 
 type AppliedMigration struct {
+	Timestamp int64                  `json:"timestamp"`
+	Name      string                 `json:"name"`
+	Checksum  string                 `json:"checksum,omitempty"`
+	Captures  map[string]interface{} `json:"captures,omitempty"`
+	Snapshots []Snapshot             `json:"snapshots,omitempty"`
+	Marked    *Mark                  `json:"marked,omitempty"`
+}
+
+// Mark records who recorded a migration as applied without sending its
+// requests, and when.
+type Mark struct {
+	User string    `json:"user"`
+	Host string    `json:"host"`
+	At   time.Time `json:"at"`
+}
+
+// NewMark returns a mark for the current user and host.
+func NewMark() Mark {
+	host, _ := os.Hostname()
+	return Mark{User: currentUser(), Host: host, At: time.Now().UTC()}
+}
+
+// AuditEntry records a change made to the state by hand with mark-applied,
+// mark-reverted or baseline. Entries are kept after the migration is reverted
+// or removed, so the state shows who changed it without sending requests.
+type AuditEntry struct {
+	Operation string `json:"operation"`
 	Timestamp int64  `json:"timestamp"`
 	Name      string `json:"name"`
+	Mark
+}
+
+// Snapshot is a resource as it was before a migration first changed it, used
+// to revert migrations declared with down: "auto". Exists is false when the
+// migration created the resource.
+type Snapshot struct {
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Exists  bool              `json:"exists"`
+	Body    interface{}       `json:"body,omitempty"`
 }
 
 type State struct {
 	AppVersion        string             `json:"app_version"`
 	AppliedMigrations []AppliedMigration `json:"applied_migrations"`
+	Audit             []AuditEntry       `json:"audit,omitempty"`
+
+	backend StateBackend
 }
 
 const stateFileName = "restmigrate.state"
 
-func LoadState(ctx context.Context, path, appVersion string) (*State, error) {
+func LoadState(ctx context.Context, backend StateBackend, appVersion string) (*State, error) {
 	ctx, span := telemetry.StartSpan(ctx, "LoadState")
 	defer span.End()
 
-	stateFilePath := filepath.Join(path, stateFileName)
-	logger.Debug("Loading state file", "path", stateFilePath)
+	logger.Debug("Loading state", "backend", backend)
 
-	data, err := os.ReadFile(stateFilePath)
-	if os.IsNotExist(err) {
-		logger.Info("State file not found, creating new state", "path", stateFilePath)
-		return &State{AppVersion: appVersion}, nil
+	data, err := backend.Read(ctx)
+	if errors.Is(err, ErrStateNotFound) {
+		logger.Info("State not found, creating new state", "backend", backend)
+		return &State{AppVersion: appVersion, backend: backend}, nil
 	} else if err != nil {
 		return nil, err
 	}
 
-	var state State
+	state := State{backend: backend}
 	err = json.Unmarshal(data, &state)
 	if err != nil {
 		return nil, err
 	}
 
-	// Update the app version if it's different
+	// Update the app version if it's different, it is persisted with the
+	// next change to the state so read only commands leave the file as is
 	if state.AppVersion != appVersion {
-		logger.Info("Updating app version in state file", "old", state.AppVersion, "new", appVersion)
+		logger.Debug("Updating app version in state", "old", state.AppVersion, "new", appVersion)
 		state.AppVersion = appVersion
-		err = state.SaveState(ctx, path)
-		if err != nil {
-			return nil, fmt.Errorf("failed to update app version in state file: %w", err)
-		}
 	}
 
 	return &state, nil
 }
 
-func (s *State) SaveState(ctx context.Context, path string) error {
-	_, span := telemetry.StartSpan(ctx, "SaveState")
+func (s *State) SaveState(ctx context.Context) error {
+	ctx, span := telemetry.StartSpan(ctx, "SaveState")
 	defer span.End()
 
-	stateFilePath := filepath.Join(path, stateFileName)
-	logger.Debug("Saving state file", "path", stateFilePath)
+	logger.Debug("Saving state", "backend", s.backend)
 
 	data, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(stateFilePath, data, 0644)
+	return s.backend.Write(ctx, data)
 }
 
-func (s *State) AddMigration(timestamp int64, name string) {
+func (s *State) AddMigration(timestamp int64, name, checksum string) {
 	s.AppliedMigrations = append(s.AppliedMigrations, AppliedMigration{
 		Timestamp: timestamp,
 		Name:      name,
+		Checksum:  checksum,
 	})
 	sort.Slice(s.AppliedMigrations, func(i, j int) bool {
 		return s.AppliedMigrations[i].Timestamp < s.AppliedMigrations[j].Timestamp
@@ -88,3 +125,82 @@ func (s *State) RemoveLastMigration() {
 		s.AppliedMigrations = s.AppliedMigrations[:len(s.AppliedMigrations)-1]
 	}
 }
+
+// RemoveMigration removes the applied migration with the given timestamp,
+// wherever it is in the order, and reports whether it was applied.
+func (s *State) RemoveMigration(timestamp int64) bool {
+	for i, m := range s.AppliedMigrations {
+		if m.Timestamp == timestamp {
+			s.AppliedMigrations = append(s.AppliedMigrations[:i], s.AppliedMigrations[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SetMark records that the migration with the given timestamp was marked as
+// applied by hand.
+func (s *State) SetMark(timestamp int64, mark Mark) {
+	for i := range s.AppliedMigrations {
+		if s.AppliedMigrations[i].Timestamp == timestamp {
+			s.AppliedMigrations[i].Marked = &mark
+			return
+		}
+	}
+}
+
+// AddAudit records that the migration with the given timestamp and name was
+// changed by hand with operation.
+func (s *State) AddAudit(operation string, timestamp int64, name string, mark Mark) {
+	s.Audit = append(s.Audit, AuditEntry{
+		Operation: operation,
+		Timestamp: timestamp,
+		Name:      name,
+		Mark:      mark,
+	})
+}
+
+// SetCaptures records the values captured while applying the migration with
+// the given timestamp, so later migrations and down can reference them.
+func (s *State) SetCaptures(timestamp int64, captures map[string]interface{}) {
+	for i := range s.AppliedMigrations {
+		if s.AppliedMigrations[i].Timestamp == timestamp {
+			s.AppliedMigrations[i].Captures = captures
+			return
+		}
+	}
+}
+
+// SetSnapshots records the snapshots taken while applying the migration with
+// the given timestamp.
+func (s *State) SetSnapshots(timestamp int64, snapshots []Snapshot) {
+	for i := range s.AppliedMigrations {
+		if s.AppliedMigrations[i].Timestamp == timestamp {
+			s.AppliedMigrations[i].Snapshots = snapshots
+			return
+		}
+	}
+}
+
+// Snapshots returns the snapshots recorded for the migration with the given
+// timestamp.
+func (s *State) Snapshots(timestamp int64) []Snapshot {
+	for _, m := range s.AppliedMigrations {
+		if m.Timestamp == timestamp {
+			return m.Snapshots
+		}
+	}
+	return nil
+}
+
+// Captures returns the values captured by all applied migrations. A later
+// migration overrides a value with the same name.
+func (s *State) Captures() map[string]interface{} {
+	captures := make(map[string]interface{})
+	for _, m := range s.AppliedMigrations {
+		for name, value := range m.Captures {
+			captures[name] = value
+		}
+	}
+	return captures
+}
@@ -0,0 +1,108 @@
+package migration
+
+import (
+	"fmt"
+	"net/http"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/format"
+	cuejson "cuelang.org/go/encoding/json"
+)
+
+// Check is a request sent to verify that a migration took effect. The JSON
+// response body is unified with the CUE value of body, which may hold
+// constraints such as `retries: >=3`, and every expression in assert must then
+// evaluate to true, e.g. `list.Contains(body.paths, "/mock")`.
+type Check struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Expect  []int             `json:"expect,omitempty"`
+
+	value cue.Value
+}
+
+// NewCheck reads a check from its CUE value. The method defaults to GET.
+func NewCheck(v cue.Value) (Check, error) {
+	var check Check
+	if err := v.Decode(&check); err != nil {
+		return Check{}, err
+	}
+	if check.Method == "" {
+		check.Method = http.MethodGet
+	}
+
+	step := check.Step()
+	if err := step.validate(); err != nil {
+		return Check{}, err
+	}
+	check.Method = step.Method
+	check.value = v
+	return check, nil
+}
+
+// Step returns the request of the check, so captures can be resolved in its
+// path and headers like in any other step.
+func (c Check) Step() Step {
+	return Step{
+		Method:  c.Method,
+		Path:    c.Path,
+		Headers: c.Headers,
+		Expect:  c.Expect,
+	}
+}
+
+// Evaluate checks the JSON response body against the body constraints and
+// assertions of the check.
+func (c Check) Evaluate(body []byte) error {
+	if !c.value.LookupPath(cue.ParsePath("body")).Exists() && !c.value.LookupPath(cue.ParsePath("assert")).Exists() {
+		// Only the status of the response is checked.
+		return nil
+	}
+
+	expr, err := cuejson.Extract(c.Path, body)
+	if err != nil {
+		return fmt.Errorf("response is not JSON: %w", err)
+	}
+	response := c.value.Context().BuildExpr(expr)
+	if response.Err() != nil {
+		return fmt.Errorf("response is not JSON: %w", response.Err())
+	}
+
+	filled := c.value.FillPath(cue.ParsePath("body"), response)
+	if err := filled.LookupPath(cue.ParsePath("body")).Validate(cue.Concrete(true)); err != nil {
+		return fmt.Errorf("response does not match: %w", err)
+	}
+
+	asserts := filled.LookupPath(cue.ParsePath("assert"))
+	if !asserts.Exists() {
+		return nil
+	}
+	iter, err := asserts.List()
+	if err != nil {
+		return fmt.Errorf("assert must be a list: %w", err)
+	}
+	for iter.Next() {
+		ok, err := iter.Value().Bool()
+		if err != nil {
+			return fmt.Errorf("assertion %s cannot be evaluated: %w", source(iter.Value()), err)
+		}
+		if !ok {
+			return fmt.Errorf("assertion failed: %s", source(iter.Value()))
+		}
+	}
+	return nil
+}
+
+// source returns the CUE expression of v as written in the migration.
+func source(v cue.Value) string {
+	node := v.Source()
+	if node == nil {
+		return fmt.Sprint(v)
+	}
+	b, err := format.Node(node)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,211 @@
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"github.com/krzko/restmigrate/internal/sigv4"
+)
+
+// Authenticator adds credentials to a request before it is sent. The payload
+// is the exact body of the request, or nil when there is none.
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *http.Request, payload []byte) error
+}
+
+// WithAuthenticator replaces the authentication of the gateway type, which
+// sends the API key in the header the gateway expects.
+func WithAuthenticator(auth Authenticator) Option {
+	return func(c *baseClient) {
+		c.auth = auth
+	}
+}
+
+// defaultAuthenticator returns how the API key is sent to gatewayType when no
+// authenticator is configured. Nothing is sent without an API key.
+func defaultAuthenticator(gatewayType, apiKey string) Authenticator {
+	if apiKey == "" {
+		return NoAuth{}
+	}
+
+	switch gatewayType {
+	case "apisix":
+		return HeaderAuth{Name: "X-API-KEY", Value: apiKey}
+	case "kong":
+		return HeaderAuth{Name: "Kong-Admin-Token", Value: apiKey}
+	case "tyk":
+		return HeaderAuth{Name: "x-tyk-authorization", Value: apiKey}
+	default:
+		return BearerAuth{Token: apiKey}
+	}
+}
+
+// authHeader returns the name of the header auth sets, or "" when it sends no
+// credentials.
+func authHeader(auth Authenticator) string {
+	switch a := auth.(type) {
+	case NoAuth:
+		return ""
+	case HeaderAuth:
+		return a.Name
+	default:
+		return "Authorization"
+	}
+}
+
+// NoAuth sends requests without credentials.
+type NoAuth struct{}
+
+func (NoAuth) Authenticate(ctx context.Context, req *http.Request, payload []byte) error {
+	return nil
+}
+
+// BearerAuth sends a static token in the Authorization header.
+type BearerAuth struct {
+	Token string
+}
+
+func (a BearerAuth) Authenticate(ctx context.Context, req *http.Request, payload []byte) error {
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+// BasicAuth sends a username and password with HTTP basic authentication.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuth) Authenticate(ctx context.Context, req *http.Request, payload []byte) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// HeaderAuth sends a static value in a custom header, e.g. an API key.
+type HeaderAuth struct {
+	Name  string
+	Value string
+}
+
+func (a HeaderAuth) Authenticate(ctx context.Context, req *http.Request, payload []byte) error {
+	req.Header.Set(a.Name, a.Value)
+	return nil
+}
+
+// SigV4Auth signs requests with AWS Signature Version 4, e.g. for admin APIs
+// behind Amazon API Gateway.
+type SigV4Auth struct {
+	Signer *sigv4.Signer
+}
+
+func (a SigV4Auth) Authenticate(ctx context.Context, req *http.Request, payload []byte) error {
+	if err := a.Signer.Sign(req, payload); err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+	return nil
+}
+
+// tokenExpiryMargin renews OAuth2 tokens shortly before they expire, so a
+// token does not run out while a request is in flight.
+const tokenExpiryMargin = 30 * time.Second
+
+// OAuth2ClientCredentials obtains a bearer token with the OAuth2 client
+// credentials grant. The token is cached and fetched again once it expires.
+type OAuth2ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	httpClient *http.Client
+	mu         sync.Mutex
+	token      string
+	expires    time.Time
+}
+
+// NewOAuth2ClientCredentials returns an authenticator requesting tokens from
+// tokenURL, connecting with tlsConfig when it is not nil.
+func NewOAuth2ClientCredentials(tokenURL, clientID, clientSecret string, scopes []string, tlsConfig *tls.Config) *OAuth2ClientCredentials {
+	return &OAuth2ClientCredentials{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		httpClient:   NewHTTPClient(tlsConfig),
+	}
+}
+
+func (a *OAuth2ClientCredentials) Authenticate(ctx context.Context, req *http.Request, payload []byte) error {
+	token, err := a.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Token returns the cached access token, requesting a new one when there is
+// none or it is about to expire.
+func (a *OAuth2ClientCredentials) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && (a.expires.IsZero() || time.Now().Before(a.expires)) {
+		return a.token, nil
+	}
+
+	logger.Debug("Requesting OAuth2 token", "token_url", a.TokenURL, "client_id", a.ClientID)
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("failed to request token: HTTP %d: %s", resp.StatusCode, body)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token response has no access_token")
+	}
+
+	a.token = token.AccessToken
+	a.expires = time.Time{}
+	if token.ExpiresIn > 0 {
+		a.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryMargin)
+	}
+	return a.token, nil
+}
@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/krzko/restmigrate/internal/sigv4"
+)
+
+func TestDryRunDoesNotAuthenticate(t *testing.T) {
+	var tokenRequests atomic.Int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests.Add(1)
+		w.Write([]byte(`{"access_token": "live-token"}`))
+	}))
+	defer tokenServer.Close()
+
+	tests := []struct {
+		name   string
+		auth   Authenticator
+		header string
+	}{
+		{name: "oauth2", auth: NewOAuth2ClientCredentials(tokenServer.URL, "id", "secret", nil, nil), header: "Authorization: ********"},
+		{name: "sigv4", auth: SigV4Auth{Signer: &sigv4.Signer{Region: "us-east-1", Service: "execute-api"}}, header: "Authorization: ********"},
+		{name: "header", auth: HeaderAuth{Name: "X-Admin", Value: "live-key"}, header: "X-Admin: ********"},
+		{name: "none", auth: NoAuth{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			client, err := NewClient("generic", "http://admin.invalid", "", WithDryRun(&out), WithAuthenticator(tt.auth))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = client.SendRequest(context.Background(), Request{Method: http.MethodPost, Endpoint: "/services", Body: map[string]string{"name": "a"}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			printed := out.String()
+			if tt.header != "" && !strings.Contains(printed, tt.header) {
+				t.Errorf("dry run output has no %q:\n%s", tt.header, printed)
+			}
+			if tt.header == "" && strings.Contains(printed, "Authorization") {
+				t.Errorf("dry run output has credentials:\n%s", printed)
+			}
+			for _, secret := range []string{"live-token", "live-key", "AWS4-HMAC-SHA256"} {
+				if strings.Contains(printed, secret) {
+					t.Errorf("dry run output contains %s:\n%s", secret, printed)
+				}
+			}
+		})
+	}
+
+	if n := tokenRequests.Load(); n != 0 {
+		t.Errorf("dry run requested %d token(s)", n)
+	}
+}
+
+func TestOAuth2TokenIsCached(t *testing.T) {
+	var tokenRequests atomic.Int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests.Add(1)
+		if user, pass, _ := r.BasicAuth(); user != "id" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if got := r.FormValue("scope"); got != "admin read" {
+			t.Errorf("scope = %q", got)
+		}
+		w.Write([]byte(`{"access_token": "token-1", "expires_in": 3600}`))
+	}))
+	defer tokenServer.Close()
+
+	var authorization []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+	}))
+	defer api.Close()
+
+	auth := NewOAuth2ClientCredentials(tokenServer.URL, "id", "secret", []string{"admin", "read"}, nil)
+	// Two clients sharing the authenticator, as the API and state clients do.
+	for i := 0; i < 2; i++ {
+		client, err := NewClient("generic", api.URL, "", WithAuthenticator(auth))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.SendRequest(context.Background(), Request{Method: http.MethodGet, Endpoint: "/"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if n := tokenRequests.Load(); n != 1 {
+		t.Errorf("requested %d tokens, want 1", n)
+	}
+	for _, got := range authorization {
+		if got != "Bearer token-1" {
+			t.Errorf("Authorization = %q", got)
+		}
+	}
+}
+
+func TestOAuth2UsesTLSConfig(t *testing.T) {
+	tokenServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token": "token-1"}`))
+	}))
+	defer tokenServer.Close()
+
+	if _, err := NewOAuth2ClientCredentials(tokenServer.URL, "id", "secret", nil, nil).Token(context.Background()); err == nil {
+		t.Fatal("token request succeeded without trusting the server certificate")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(tokenServer.Certificate())
+	auth := NewOAuth2ClientCredentials(tokenServer.URL, "id", "secret", nil, &tls.Config{RootCAs: pool})
+	if token, err := auth.Token(context.Background()); err != nil || token != "token-1" {
+		t.Errorf("got %q, %v", token, err)
+	}
+}
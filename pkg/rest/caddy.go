@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// CaddyClient talks to the Caddy admin API. Paths starting with @ address an
+// object by its @id, e.g. @my_route/handle/0 becomes /id/my_route/handle/0.
+// Writes are guarded with the Etag of the addressed config. A write that fails
+// its precondition because the config changed concurrently fails the step, it
+// is not retried on top of the other edit.
+type CaddyClient struct {
+	*baseClient
+}
+
+func (c *CaddyClient) SendRequest(ctx context.Context, req Request) (*Response, error) {
+	req.Endpoint = caddyEndpoint(req.Endpoint)
+	// /load only accepts POST, the whole config is replaced either way
+	if req.Endpoint == "/load" && req.Method == http.MethodPut {
+		req.Method = http.MethodPost
+	}
+
+	if c.dryRun != nil || req.Method == http.MethodGet || hasHeader(req.Headers, "If-Match") {
+		return c.sendRequest(ctx, req)
+	}
+
+	etag, err := c.etag(ctx, req.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	guarded := req
+	guarded.Headers = make(map[string]string, len(req.Headers)+1)
+	for key, value := range req.Headers {
+		guarded.Headers[key] = value
+	}
+	guarded.Headers["If-Match"] = etag
+
+	resp, err := c.sendRequest(ctx, guarded)
+	var errResp *ErrorResponse
+	if errors.As(err, &errResp) && errResp.StatusCode == http.StatusPreconditionFailed {
+		logger.Error("Caddy config changed concurrently", "endpoint", req.Endpoint)
+		return resp, fmt.Errorf("caddy config at %s was changed by someone else, not overwriting it: %w", req.Endpoint, err)
+	}
+	return resp, err
+}
+
+// etag returns the Etag of the config addressed by endpoint. Objects that do
+// not exist yet are guarded by the Etag of the whole config.
+func (c *CaddyClient) etag(ctx context.Context, endpoint string) (string, error) {
+	targets := []string{endpoint, "/config/"}
+	if endpoint == "/load" || endpoint == "/config/" {
+		targets = []string{"/config/"}
+	}
+
+	for _, target := range targets {
+		etag, err := c.fetchEtag(ctx, target)
+		if err != nil || etag != "" {
+			return etag, err
+		}
+	}
+	return "", fmt.Errorf("caddy did not return an Etag for %s", endpoint)
+}
+
+func (c *CaddyClient) fetchEtag(ctx context.Context, endpoint string) (string, error) {
+	url := fmt.Sprintf("%s%s", c.baseURL, endpoint)
+	ctx, span := otel.Tracer("restmigrate/client").Start(ctx, fmt.Sprintf("GET %s", endpoint))
+	defer span.End()
+	span.SetAttributes(attribute.String("restmigrate.caddy.purpose", "etag"))
+
+	req, err := c.createRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return "", c.handleError(span, "Failed to create request", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", c.handleError(span, "Failed to send request", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	c.setSpanAttributes(span, http.MethodGet, url, resp.StatusCode, "")
+	span.SetStatus(codes.Ok, "")
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		logger.Debug("No Etag for Caddy config", "endpoint", endpoint, "status", resp.StatusCode)
+		return "", nil
+	}
+	return resp.Header.Get("Etag"), nil
+}
+
+// caddyEndpoint rewrites @id addressing to the /id/ endpoint and makes sure
+// the config root keeps its trailing slash.
+func caddyEndpoint(endpoint string) string {
+	switch {
+	case strings.HasPrefix(endpoint, "@"):
+		return "/id/" + strings.TrimPrefix(endpoint, "@")
+	case strings.HasPrefix(endpoint, "/@"):
+		return "/id/" + strings.TrimPrefix(endpoint, "/@")
+	case endpoint == "/config":
+		return "/config/"
+	}
+	return endpoint
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// caddyServer answers GET with an Etag and fails writes whose If-Match does
+// not match it with 412.
+type caddyServer struct {
+	mu     sync.Mutex
+	etag   string
+	writes []*http.Request
+	// editAfterRead changes the Etag after every GET, as if someone else
+	// edited the config right after it was read.
+	editAfterRead bool
+}
+
+func (s *caddyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Etag", s.etag)
+		w.Write([]byte(`{}`))
+		if s.editAfterRead {
+			s.etag += "'"
+		}
+		return
+	}
+	s.writes = append(s.writes, r)
+	if r.Header.Get("If-Match") != s.etag {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestCaddyWriteSendsEtag(t *testing.T) {
+	caddy := &caddyServer{etag: `"/id/http_upstream abc"`}
+	srv := httptest.NewServer(caddy)
+	defer srv.Close()
+
+	client, err := NewClient("caddy", srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.SendRequest(context.Background(), Request{Method: http.MethodPatch, Endpoint: "@http_upstream/dial", Body: []string{"localhost:8081"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(caddy.writes) != 1 {
+		t.Fatalf("got %d writes, want 1", len(caddy.writes))
+	}
+	write := caddy.writes[0]
+	if write.URL.Path != "/id/http_upstream/dial" {
+		t.Errorf("path = %s", write.URL.Path)
+	}
+	if got := write.Header.Get("If-Match"); got != caddy.etag {
+		t.Errorf("If-Match = %q, want %q", got, caddy.etag)
+	}
+}
+
+func TestCaddyConcurrentEditIsNotRetried(t *testing.T) {
+	caddy := &caddyServer{etag: `"/config/ abc"`, editAfterRead: true}
+	srv := httptest.NewServer(caddy)
+	defer srv.Close()
+
+	client, err := NewClient("caddy", srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.SendRequest(context.Background(), Request{Method: http.MethodPut, Endpoint: "/load", Body: map[string]interface{}{}})
+
+	var errResp *ErrorResponse
+	if !errors.As(err, &errResp) || errResp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("got %v, want a 412 error", err)
+	}
+	if len(caddy.writes) != 1 {
+		t.Fatalf("got %d writes, want the write not to be retried", len(caddy.writes))
+	}
+	if caddy.writes[0].Method != http.MethodPost {
+		t.Errorf("method = %s, want PUT /load sent as POST", caddy.writes[0].Method)
+	}
+}
+
+func TestCaddyStaleEtagFailsStep(t *testing.T) {
+	caddy := &caddyServer{etag: `"/config/ new"`}
+	srv := httptest.NewServer(caddy)
+	defer srv.Close()
+
+	client, err := NewClient("caddy", srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The step carries the Etag its change was based on, the config has
+	// changed since.
+	_, err = client.SendRequest(context.Background(), Request{
+		Method:   http.MethodPatch,
+		Endpoint: "/config/apps/layer4/servers/socks/listen",
+		Body:     []string{"0.0.0.0:3001"},
+		Headers:  map[string]string{"If-Match": `"/config/ old"`},
+	})
+
+	var errResp *ErrorResponse
+	if !errors.As(err, &errResp) || errResp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("got %v, want a 412 error", err)
+	}
+	if len(caddy.writes) != 1 {
+		t.Errorf("got %d writes, want the write not to be retried", len(caddy.writes))
+	}
+}
+
+func TestCaddyEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"@http_upstream/dial":  "/id/http_upstream/dial",
+		"/@http_upstream/dial": "/id/http_upstream/dial",
+		"/config":              "/config/",
+		"/config/apps":         "/config/apps",
+		"/load":                "/load",
+	}
+	for endpoint, want := range tests {
+		if got := caddyEndpoint(endpoint); got != want {
+			t.Errorf("caddyEndpoint(%q) = %q, want %q", endpoint, got, want)
+		}
+	}
+}
@@ -3,14 +3,18 @@ package rest
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/krzko/restmigrate/internal/logger"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -19,13 +23,96 @@ import (
 )
 
 type Client interface {
-	SendRequest(ctx context.Context, method, endpoint string, payload interface{}) error
+	SendRequest(ctx context.Context, req Request) (*Response, error)
+}
+
+// AfterMigrationHook is implemented by clients that need to act once the
+// requests of a migration have been sent, e.g. to reload the gateway.
+type AfterMigrationHook interface {
+	AfterMigration(ctx context.Context) error
+}
+
+// ErrReadOnly is returned for writes to gateways whose API cannot change
+// their configuration.
+var ErrReadOnly = errors.New("gateway API is read-only")
+
+// Request describes a single call against the target API. Headers are sent in
+// addition to the gateway specific authentication headers.
+//
+// A response with a 2xx status is successful. Expect replaces the statuses
+// that are successful, IgnoreStatus adds to them.
+type Request struct {
+	Method       string
+	Endpoint     string
+	Body         interface{}
+	Headers      map[string]string
+	Expect       []int
+	IgnoreStatus []int
+}
+
+// accepts reports whether status counts as success for the request.
+func (r Request) accepts(status int) bool {
+	if containsStatus(r.IgnoreStatus, status) {
+		return true
+	}
+	if len(r.Expect) > 0 {
+		return containsStatus(r.Expect, status)
+	}
+	return status >= 200 && status < 300
+}
+
+func containsStatus(statuses []int, status int) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Response is a successful reply from the target API. In dry run mode no
+// request is sent and the response is empty.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
 }
 
 type baseClient struct {
-	baseURL    string
-	apiKey     string
-	httpClient *http.Client
+	baseURL        string
+	httpClient     *http.Client
+	dryRun         io.Writer
+	dryRunSecrets  []string
+	tlsConfig      *tls.Config
+	retry          RetryPolicy
+	requestTimeout time.Duration
+	auth           Authenticator
+	reload         *Request
+	health         *HealthCheck
+}
+
+// Option configures optional behaviour of a Client.
+type Option func(*baseClient)
+
+// WithDryRun makes the client write every request it would send to w instead
+// of sending it. Header values that look like credentials are masked.
+func WithDryRun(w io.Writer) Option {
+	return func(c *baseClient) {
+		c.dryRun = w
+	}
+}
+
+// WithDryRunVars masks the values of the variables in vars whose names look
+// like credentials, e.g. api_token or db_password, wherever they appear in the
+// requests printed in dry run mode.
+func WithDryRunVars(vars map[string]string) Option {
+	return func(c *baseClient) {
+		for name, value := range vars {
+			if value != "" && sensitiveName(name) {
+				c.dryRunSecrets = append(c.dryRunSecrets, value)
+			}
+		}
+	}
 }
 
 type ErrorResponse struct {
@@ -37,63 +124,159 @@ func (e *ErrorResponse) Error() string {
 	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Body)
 }
 
-func NewClient(gatewayType, baseURL, apiKey string) (Client, error) {
+func NewClient(gatewayType, baseURL, apiKey string, opts ...Option) (Client, error) {
 	base := &baseClient{
 		baseURL: strings.TrimRight(baseURL, "/"),
-		apiKey:  apiKey,
-		httpClient: &http.Client{
-			Transport: otelhttp.NewTransport(http.DefaultTransport),
-		},
+	}
+	for _, opt := range opts {
+		opt(base)
+	}
+
+	base.httpClient = NewHTTPClient(base.tlsConfig)
+	if base.auth == nil {
+		base.auth = defaultAuthenticator(gatewayType, apiKey)
 	}
 
+	var client Client
 	switch gatewayType {
 	case "apisix":
-		return &APISIXClient{baseClient: base}, nil
+		client = &APISIXClient{baseClient: base}
 	case "kong":
-		return &KongClient{baseClient: base}, nil
+		client = &KongClient{baseClient: base}
+	case "caddy":
+		client = &CaddyClient{baseClient: base}
+	case "krakend":
+		client = &KrakenDClient{baseClient: base}
+	case "traefik":
+		client = &TraefikClient{baseClient: base}
+	case "tyk":
+		client = &TykClient{baseClient: base}
 	case "generic":
-		return &GenericClient{baseClient: base}, nil
+		client = &GenericClient{baseClient: base}
 	default:
 		return nil, fmt.Errorf("unsupported gateway type: %s", gatewayType)
 	}
+
+	if base.reload != nil || base.health != nil {
+		return &hookedClient{Client: client, base: base}, nil
+	}
+	return client, nil
 }
 
-func (c *baseClient) sendRequest(ctx context.Context, method, endpoint string, payload interface{}, headers map[string]string) error {
-	url := fmt.Sprintf("%s%s", c.baseURL, endpoint)
-	ctx, span := otel.Tracer("restmigrate/client").Start(ctx, fmt.Sprintf("%s %s", method, endpoint))
+func (c *baseClient) sendRequest(ctx context.Context, request Request) (*Response, error) {
+	method := request.Method
+	url := fmt.Sprintf("%s%s", c.baseURL, request.Endpoint)
+	ctx, span := otel.Tracer("restmigrate/client").Start(ctx, fmt.Sprintf("%s %s", method, request.Endpoint))
 	defer span.End()
 
-	req, err := c.createRequest(ctx, method, url, payload, headers)
-	if err != nil {
-		return c.handleError(span, "Failed to create request", err)
+	if c.dryRun != nil {
+		req, err := c.createRequest(ctx, method, url, request.Body, request.Headers)
+		if err != nil {
+			return nil, c.handleError(span, "Failed to create request", err)
+		}
+		span.SetAttributes(attribute.Bool("restmigrate.dry_run", true))
+		return &Response{}, c.writeDryRun(req, request.Body)
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return c.handleError(span, "Failed to send request", err)
-	}
-	defer resp.Body.Close()
+	var resp *http.Response
+	var responseBody []byte
+	for attempt := 1; ; attempt++ {
+		req, err := c.createRequest(ctx, method, url, request.Body, request.Headers)
+		if err != nil {
+			return nil, c.handleError(span, "Failed to create request", err)
+		}
 
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return c.handleError(span, "Failed to read response body", err)
+		var written bool
+		resp, responseBody, written, err = c.attempt(req)
+		retryable := err != nil && retryableError(method, written) ||
+			err == nil && c.retry.retryableStatus(method, resp.StatusCode) && !request.accepts(resp.StatusCode)
+		retry := retryable && attempt < c.retry.MaxAttempts && ctx.Err() == nil
+		if !retry {
+			if err != nil {
+				return nil, c.handleError(span, "Failed to send request", err)
+			}
+			span.SetAttributes(attribute.Int("restmigrate.attempts", attempt))
+			break
+		}
+
+		backoff := c.retry.backoff(attempt)
+		event := []attribute.KeyValue{attribute.Int("attempt", attempt)}
+		if err != nil {
+			event = append(event, attribute.String("error", err.Error()))
+		} else {
+			event = append(event, attribute.Int("http.status_code", resp.StatusCode))
+			if wait := c.retry.retryAfter(resp.Header); wait > backoff {
+				backoff = wait
+			}
+		}
+		event = append(event, attribute.String("backoff", backoff.String()))
+		span.AddEvent("retry", trace.WithAttributes(event...))
+		logger.Warn("Request failed, retrying", "method", method, "url", url, "attempt", attempt, "backoff", backoff, "error", retryReason(resp, err))
+
+		select {
+		case <-ctx.Done():
+			return nil, c.handleError(span, "Failed to send request", ctx.Err())
+		case <-time.After(backoff):
+		}
 	}
 
 	c.setSpanAttributes(span, method, url, resp.StatusCode, string(responseBody))
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return c.handleErrorResponse(span, method, url, resp.StatusCode, string(responseBody))
+	if !request.accepts(resp.StatusCode) {
+		return nil, c.handleErrorResponse(span, method, url, resp.StatusCode, string(responseBody))
 	}
 
 	c.logSuccess(method, url, resp.Status, string(responseBody))
 	span.SetStatus(codes.Ok, "")
-	return nil
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       responseBody,
+	}, nil
+}
+
+// attempt sends req once, bounded by the request timeout, and reads the
+// response body. The boolean reports whether the request was written to the
+// connection, in which case a failed attempt may have reached the gateway.
+func (c *baseClient) attempt(req *http.Request) (*http.Response, []byte, bool, error) {
+	// The transport writes the request on its own goroutine.
+	var written atomic.Bool
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		WroteHeaders: func() { written.Store(true) },
+	})
+	if c.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.requestTimeout)
+		defer cancel()
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, written.Load(), err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, true, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return resp, body, true, nil
+}
+
+func retryReason(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
 }
 
 func (c *baseClient) createRequest(ctx context.Context, method, url string, payload interface{}, headers map[string]string) (*http.Request, error) {
 	var body io.Reader
+	var jsonPayload []byte
 	if payload != nil {
-		jsonPayload, err := json.Marshal(payload)
+		var err error
+		jsonPayload, err = json.Marshal(payload)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal payload: %w", err)
 		}
@@ -111,6 +294,19 @@ func (c *baseClient) createRequest(ctx context.Context, method, url string, payl
 	}
 
 	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	// A dry run must not request tokens or sign with live credentials, it
+	// only shows which header would carry them.
+	if c.dryRun != nil {
+		if name := authHeader(c.auth); name != "" {
+			req.Header.Set(name, maskedValue)
+		}
+		return req, nil
+	}
+
+	if err := c.auth.Authenticate(ctx, req, jsonPayload); err != nil {
+		return nil, fmt.Errorf("failed to authenticate request: %w", err)
+	}
 	return req, nil
 }
 
@@ -156,31 +352,22 @@ type APISIXClient struct {
 	*baseClient
 }
 
-func (c *APISIXClient) SendRequest(ctx context.Context, method, endpoint string, payload interface{}) error {
-	headers := map[string]string{
-		"X-API-KEY": c.apiKey,
-	}
-	return c.sendRequest(ctx, method, endpoint, payload, headers)
+func (c *APISIXClient) SendRequest(ctx context.Context, req Request) (*Response, error) {
+	return c.sendRequest(ctx, req)
 }
 
 type KongClient struct {
 	*baseClient
 }
 
-func (c *KongClient) SendRequest(ctx context.Context, method, endpoint string, payload interface{}) error {
-	headers := map[string]string{
-		"Kong-Admin-Token": c.apiKey,
-	}
-	return c.sendRequest(ctx, method, endpoint, payload, headers)
+func (c *KongClient) SendRequest(ctx context.Context, req Request) (*Response, error) {
+	return c.sendRequest(ctx, req)
 }
 
 type GenericClient struct {
 	*baseClient
 }
 
-func (c *GenericClient) SendRequest(ctx context.Context, method, endpoint string, payload interface{}) error {
-	headers := map[string]string{
-		"Authorization": fmt.Sprintf("Bearer %s", c.apiKey),
-	}
-	return c.sendRequest(ctx, method, endpoint, payload, headers)
+func (c *GenericClient) SendRequest(ctx context.Context, req Request) (*Response, error) {
+	return c.sendRequest(ctx, req)
 }
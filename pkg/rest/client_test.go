@@ -0,0 +1,69 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestAccepts(t *testing.T) {
+	tests := []struct {
+		name    string
+		request Request
+		status  int
+		want    bool
+	}{
+		{name: "2xx by default", request: Request{}, status: http.StatusCreated, want: true},
+		{name: "4xx by default", request: Request{}, status: http.StatusConflict, want: false},
+		{name: "3xx by default", request: Request{}, status: http.StatusNotModified, want: false},
+		{name: "expected", request: Request{Expect: []int{http.StatusNotFound}}, status: http.StatusNotFound, want: true},
+		{name: "expect replaces 2xx", request: Request{Expect: []int{http.StatusCreated}}, status: http.StatusOK, want: false},
+		{name: "ignored", request: Request{IgnoreStatus: []int{http.StatusConflict}}, status: http.StatusConflict, want: true},
+		{name: "ignore keeps 2xx", request: Request{IgnoreStatus: []int{http.StatusConflict}}, status: http.StatusOK, want: true},
+		{name: "ignore and expect", request: Request{Expect: []int{http.StatusCreated}, IgnoreStatus: []int{http.StatusConflict}}, status: http.StatusConflict, want: true},
+		{name: "neither expected nor ignored", request: Request{Expect: []int{http.StatusCreated}, IgnoreStatus: []int{http.StatusConflict}}, status: http.StatusOK, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.request.accepts(tt.status); got != tt.want {
+				t.Errorf("accepts(%d) = %t, want %t", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendRequestStatus(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("generic", srv.URL, "", WithRetryPolicy(testRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An expected status is not retried even when it is retryable.
+	resp, err := client.SendRequest(context.Background(), Request{Method: http.MethodGet, Endpoint: "/", Expect: []int{http.StatusServiceUnavailable}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || requests != 1 {
+		t.Errorf("got status %d after %d requests, want 503 after 1", resp.StatusCode, requests)
+	}
+
+	requests = 0
+	_, err = client.SendRequest(context.Background(), Request{Method: http.MethodGet, Endpoint: "/"})
+	var errResp *ErrorResponse
+	if !errors.As(err, &errResp) || errResp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got %v, want a 503 error", err)
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests, want 3", requests)
+	}
+}
@@ -0,0 +1,85 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const maskedValue = "********"
+
+// sensitiveNameParts mark header and variable names whose values are masked.
+var sensitiveNameParts = []string{
+	"authorization",
+	"token",
+	"key",
+	"secret",
+	"password",
+	"cookie",
+	"signature",
+	"credential",
+}
+
+// writeDryRun prints req to the dry run writer. Credential headers and the
+// values of secret variables are masked.
+func (c *baseClient) writeDryRun(req *http.Request, payload interface{}) error {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%s %s\n", req.Method, req.URL.String())
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range req.Header.Values(name) {
+			fmt.Fprintf(&sb, "  %s: %s\n", name, maskHeader(name, value))
+		}
+	}
+
+	if payload != nil {
+		body, err := json.MarshalIndent(payload, "  ", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		fmt.Fprintf(&sb, "  %s\n", body)
+	}
+	sb.WriteString("\n")
+
+	_, err := io.WriteString(c.dryRun, maskSecrets(sb.String(), c.dryRunSecrets))
+	return err
+}
+
+// maskSecrets replaces every occurrence of secrets in s, either as is or JSON
+// encoded as in a request body.
+func maskSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, maskedValue)
+		if encoded, err := json.Marshal(secret); err == nil {
+			s = strings.ReplaceAll(s, strings.Trim(string(encoded), `"`), maskedValue)
+		}
+	}
+	return s
+}
+
+func maskHeader(name, value string) string {
+	if value == "" || !sensitiveName(name) {
+		return value
+	}
+	return maskedValue
+}
+
+// sensitiveName reports whether name looks like it holds a credential.
+func sensitiveName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, part := range sensitiveNameParts {
+		if strings.Contains(lower, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDryRunMasksSecretVars(t *testing.T) {
+	vars := map[string]string{
+		"upstream_host": "httpbin.internal",
+		"db_password":   "p@ss<word>",
+		"api_token":     "tok-123",
+		"empty_secret":  "",
+	}
+
+	var out bytes.Buffer
+	client, err := NewClient("generic", "http://admin.invalid", "", WithDryRun(&out), WithDryRunVars(vars))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.SendRequest(context.Background(), Request{
+		Method:   http.MethodPut,
+		Endpoint: "/upstreams/1?token=tok-123",
+		Body: map[string]interface{}{
+			"nodes":    map[string]int{"httpbin.internal:80": 1},
+			"password": "p@ss<word>",
+		},
+		Headers: map[string]string{"X-Trace": "tok-123"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	printed := out.String()
+	for _, secret := range []string{"tok-123", "p@ss", `\u003cword`} {
+		if strings.Contains(printed, secret) {
+			t.Errorf("dry run output contains %s:\n%s", secret, printed)
+		}
+	}
+	if !strings.Contains(printed, "httpbin.internal:80") {
+		t.Errorf("dry run output masks a variable that is not secret:\n%s", printed)
+	}
+	if !strings.Contains(printed, `"password": "********"`) {
+		t.Errorf("dry run output has no masked password:\n%s", printed)
+	}
+}
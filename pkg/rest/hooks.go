@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/krzko/restmigrate/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// HealthCheck polls Endpoint after each migration until it answers with a 2xx
+// status, so the next migration only starts once the gateway applied the
+// previous one.
+type HealthCheck struct {
+	Endpoint string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// WithReload sends req after each migration, for admin APIs that only apply
+// configuration changes on an explicit reload.
+func WithReload(req Request) Option {
+	return func(c *baseClient) {
+		c.reload = &req
+	}
+}
+
+// WithHealthCheck waits for the gateway to report healthy after each
+// migration, after any reload.
+func WithHealthCheck(check HealthCheck) Option {
+	return func(c *baseClient) {
+		c.health = &check
+	}
+}
+
+// hookedClient adds the configured reload and health check to the post
+// migration hook of the gateway client.
+type hookedClient struct {
+	Client
+	base *baseClient
+}
+
+func (c *hookedClient) AfterMigration(ctx context.Context) error {
+	if hook, ok := c.Client.(AfterMigrationHook); ok {
+		if err := hook.AfterMigration(ctx); err != nil {
+			return err
+		}
+	}
+
+	if c.base.reload != nil {
+		logger.Info("Reloading gateway", "method", c.base.reload.Method, "endpoint", c.base.reload.Endpoint)
+		if _, err := c.Client.SendRequest(ctx, *c.base.reload); err != nil {
+			return fmt.Errorf("failed to reload gateway: %w", err)
+		}
+	}
+
+	if c.base.health != nil {
+		return c.waitHealthy(ctx, *c.base.health)
+	}
+	return nil
+}
+
+func (c *hookedClient) waitHealthy(ctx context.Context, check HealthCheck) error {
+	if check.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, check.Timeout)
+		defer cancel()
+	}
+	interval := check.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	logger.Info("Waiting for gateway to become healthy", "endpoint", check.Endpoint)
+	for attempt := 1; ; attempt++ {
+		status, err := c.base.probe(ctx, check.Endpoint)
+		if err == nil && status >= 200 && status < 300 {
+			logger.Info("Gateway is healthy", "endpoint", check.Endpoint, "attempts", attempt)
+			return nil
+		}
+		logger.Debug("Gateway is not healthy yet", "endpoint", check.Endpoint, "status", status, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gateway did not become healthy on %s within %s", check.Endpoint, check.Timeout)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// probe sends a GET to endpoint and returns its status code, a non-2xx status
+// is not an error. In dry run mode the request is printed and reported healthy.
+func (c *baseClient) probe(ctx context.Context, endpoint string) (int, error) {
+	url := fmt.Sprintf("%s%s", c.baseURL, endpoint)
+	ctx, span := otel.Tracer("restmigrate/client").Start(ctx, fmt.Sprintf("GET %s", endpoint))
+	defer span.End()
+	span.SetAttributes(attribute.String("restmigrate.hook", "health"))
+
+	req, err := c.createRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return 0, c.handleError(span, "Failed to create request", err)
+	}
+
+	if c.dryRun != nil {
+		span.SetAttributes(attribute.Bool("restmigrate.dry_run", true))
+		return http.StatusOK, c.writeDryRun(req, nil)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, c.handleError(span, "Failed to send request", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	c.setSpanAttributes(span, http.MethodGet, url, resp.StatusCode, "")
+	span.SetStatus(codes.Ok, "")
+	return resp.StatusCode, nil
+}
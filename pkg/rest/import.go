@@ -0,0 +1,241 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/krzko/restmigrate/internal/logger"
+)
+
+// ImportedResource is a configuration object read from the gateway, with the
+// endpoint it can be created at with PUT and deleted from.
+type ImportedResource struct {
+	Kind     string
+	ID       string
+	Endpoint string
+	Body     map[string]interface{}
+}
+
+// Importer is implemented by clients that can list the configuration of the
+// gateway. Resources are returned in an order they can be created in, e.g.
+// services before the routes that reference them.
+type Importer interface {
+	ImportResources(ctx context.Context) ([]ImportedResource, error)
+}
+
+// kongImportKinds are the Kong entities imported, in creation order.
+var kongImportKinds = []string{"upstreams", "services", "routes", "consumers", "plugins"}
+
+// ImportResources lists the Kong entities, following the pagination of the
+// Admin API. The records restmigrate keeps its own state in are skipped.
+func (c *KongClient) ImportResources(ctx context.Context) ([]ImportedResource, error) {
+	var resources []ImportedResource
+	for _, kind := range kongImportKinds {
+		next := "/" + kind
+		for next != "" {
+			var page struct {
+				Data []map[string]interface{} `json:"data"`
+				Next *string                  `json:"next"`
+			}
+			if err := c.importRequest(ctx, next, &page); err != nil {
+				return nil, fmt.Errorf("failed to list %s: %w", kind, err)
+			}
+
+			for _, entity := range page.Data {
+				if hasTag(entity, stateTag) {
+					continue
+				}
+				id, _ := entity["id"].(string)
+				if id == "" {
+					return nil, fmt.Errorf("%s entity without id", kind)
+				}
+				resources = append(resources, ImportedResource{
+					Kind:     kind,
+					ID:       id,
+					Endpoint: fmt.Sprintf("/%s/%s", kind, id),
+					Body:     cleanImported(entity, generatedFields["kong"]...),
+				})
+			}
+
+			next = ""
+			if page.Next != nil && *page.Next != "" {
+				link, err := url.Parse(*page.Next)
+				if err != nil {
+					return nil, fmt.Errorf("invalid next page of %s: %w", kind, err)
+				}
+				// Kong returns the link either relative or as an absolute URL.
+				next = link.RequestURI()
+			}
+		}
+	}
+	return resources, nil
+}
+
+// apisixImportKinds are the APISIX resources imported, in creation order. SSLs
+// are not imported, the Admin API does not return their private keys, so a
+// PUT of what it returns cannot recreate them.
+var apisixImportKinds = []string{"upstreams", "services", "routes"}
+
+// ImportResources lists the APISIX resources of the Admin API, which returns
+// each of them wrapped in its etcd key and value.
+func (c *APISIXClient) ImportResources(ctx context.Context) ([]ImportedResource, error) {
+	ssls, err := c.listResources(ctx, "ssls")
+	if err != nil {
+		return nil, err
+	}
+	if len(ssls) > 0 {
+		ids := make([]string, 0, len(ssls))
+		for _, ssl := range ssls {
+			ids = append(ids, fmt.Sprint(ssl["id"]))
+		}
+		logger.Warn("SSLs are not imported as the Admin API does not return their private keys, add them in a migration of their own", "ids", strings.Join(ids, ","))
+	}
+
+	var resources []ImportedResource
+	for _, kind := range apisixImportKinds {
+		values, err := c.listResources(ctx, kind)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			id := fmt.Sprint(value["id"])
+			if value["id"] == nil || id == "" {
+				return nil, fmt.Errorf("%s resource without id", kind)
+			}
+			resources = append(resources, ImportedResource{
+				Kind:     kind,
+				ID:       id,
+				Endpoint: fmt.Sprintf("/apisix/admin/%s/%s", kind, id),
+				Body:     cleanImported(value, generatedFields["apisix"]...),
+			})
+		}
+	}
+	return resources, nil
+}
+
+// listResources returns the values of the APISIX resources of kind.
+func (c *APISIXClient) listResources(ctx context.Context, kind string) ([]map[string]interface{}, error) {
+	var list struct {
+		// APISIX encodes an empty list as an object.
+		List json.RawMessage `json:"list"`
+		Node struct {
+			Nodes json.RawMessage `json:"nodes"`
+		} `json:"node"`
+	}
+	if err := c.importRequest(ctx, "/apisix/admin/"+kind, &list); err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", kind, err)
+	}
+
+	var values []map[string]interface{}
+	for _, raw := range []json.RawMessage{list.List, list.Node.Nodes} {
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 || raw[0] != '[' {
+			continue
+		}
+		var items []struct {
+			Value map[string]interface{} `json:"value"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&items); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", kind, err)
+		}
+		for _, item := range items {
+			values = append(values, item.Value)
+		}
+	}
+	return values, nil
+}
+
+// importRequest lists resources at endpoint and decodes the response into v.
+// Numbers are kept as json.Number so large integers are not rounded.
+func (c *baseClient) importRequest(ctx context.Context, endpoint string, v interface{}) error {
+	resp, err := c.sendRequest(ctx, Request{Method: http.MethodGet, Endpoint: endpoint})
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(resp.Body))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// generatedFields are set by the gateway when a resource is written. The id is
+// part of the endpoint of the resource.
+var generatedFields = map[string][]string{
+	"apisix": {"id", "create_time", "update_time"},
+	"kong":   {"id", "created_at", "updated_at"},
+}
+
+// DecodeResource decodes a single resource read from the gateway into a body
+// it can be written back with. APISIX resources are unwrapped from their etcd
+// key and value, and generated and null fields are dropped.
+func DecodeResource(gatewayType string, body []byte) (interface{}, error) {
+	if gatewayType == "apisix" {
+		body = unwrapAPISIXValue(body)
+	}
+
+	var resource interface{}
+	if err := json.Unmarshal(body, &resource); err != nil {
+		return nil, fmt.Errorf("failed to decode resource: %w", err)
+	}
+	if object, ok := resource.(map[string]interface{}); ok {
+		return cleanImported(object, generatedFields[gatewayType]...), nil
+	}
+	return resource, nil
+}
+
+// cleanImported drops generated fields and null values, which Kong and APISIX
+// return for every optional field that is not set.
+func cleanImported(object map[string]interface{}, generated ...string) map[string]interface{} {
+	cleaned := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		if value == nil || containsString(generated, key) {
+			continue
+		}
+		cleaned[key] = cleanValue(value)
+	}
+	return cleaned
+}
+
+func cleanValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return cleanImported(value)
+	case []interface{}:
+		cleaned := make([]interface{}, len(value))
+		for i, item := range value {
+			cleaned[i] = cleanValue(item)
+		}
+		return cleaned
+	default:
+		return value
+	}
+}
+
+func hasTag(entity map[string]interface{}, tag string) bool {
+	tags, _ := entity["tags"].([]interface{})
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
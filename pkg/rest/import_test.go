@@ -0,0 +1,54 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPISIXImportSkipsSSLs(t *testing.T) {
+	responses := map[string]string{
+		"/apisix/admin/ssls":      `{"total": 1, "list": [{"key": "/apisix/ssls/1", "value": {"id": "1", "cert": "-----BEGIN CERTIFICATE-----", "snis": ["example.com"]}}]}`,
+		"/apisix/admin/upstreams": `{"total": 1, "list": [{"key": "/apisix/upstreams/u1", "value": {"id": "u1", "type": "roundrobin", "nodes": {"httpbin:80": 1}, "create_time": 1719831943}}]}`,
+		"/apisix/admin/services":  `{"total": 0, "list": {}}`,
+		"/apisix/admin/routes":    `{"total": 1, "list": [{"key": "/apisix/routes/r1", "value": {"id": "r1", "uri": "/get", "upstream_id": "u1"}}]}`,
+	}
+	var listed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listed = append(listed, r.URL.Path)
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("apisix", srv.URL, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, err := client.(Importer).ImportResources(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(listed) != 4 {
+		t.Errorf("listed %v, want all four kinds", listed)
+	}
+	var endpoints []string
+	for _, r := range resources {
+		if r.Kind == "ssls" {
+			t.Errorf("imported ssl %s", r.ID)
+		}
+		endpoints = append(endpoints, r.Endpoint)
+	}
+	if len(endpoints) != 2 || endpoints[0] != "/apisix/admin/upstreams/u1" || endpoints[1] != "/apisix/admin/routes/r1" {
+		t.Errorf("got %v", endpoints)
+	}
+	if _, ok := resources[0].Body["create_time"]; ok {
+		t.Errorf("generated field was imported: %v", resources[0].Body)
+	}
+}
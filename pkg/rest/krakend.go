@@ -0,0 +1,31 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// KrakenDClient talks to a KrakenD gateway. KrakenD is stateless and loads
+// its configuration from a file at start up, so only reads of its
+// operational endpoints are sent. After a migration the gateway must report
+// healthy on /__health.
+type KrakenDClient struct {
+	*baseClient
+}
+
+func (c *KrakenDClient) SendRequest(ctx context.Context, req Request) (*Response, error) {
+	if req.Method != http.MethodGet {
+		return nil, fmt.Errorf("%w: cannot %s %s, KrakenD loads its configuration from krakend.json, "+
+			"generate it with flexible configuration and roll it out with your deployment", ErrReadOnly, req.Method, req.Endpoint)
+	}
+	return c.sendRequest(ctx, req)
+}
+
+func (c *KrakenDClient) AfterMigration(ctx context.Context) error {
+	_, err := c.sendRequest(ctx, Request{Method: http.MethodGet, Endpoint: "/__health"})
+	if err != nil {
+		return fmt.Errorf("KrakenD is not healthy: %w", err)
+	}
+	return nil
+}
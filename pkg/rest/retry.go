@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how requests failing with a transient error are
+// retried. Connection errors and the RetryableStatus codes are retried with
+// exponential backoff and jitter, a Retry-After header extends the wait up to
+// MaxBackoff. Requests that are not idempotent are only retried when the
+// gateway cannot have applied them.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, 1 disables retries.
+	MaxAttempts     int
+	InitialBackoff  time.Duration
+	MaxBackoff      time.Duration
+	RetryableStatus []int
+}
+
+// DefaultRetryableStatus are the statuses gateways answer with while they
+// are overloaded or restarting.
+var DefaultRetryableStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// WithRetryPolicy retries requests failing with a transient error.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *baseClient) {
+		c.retry = policy
+	}
+}
+
+// WithRequestTimeout bounds each attempt of a request, including reading the
+// response body.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(c *baseClient) {
+		c.requestTimeout = timeout
+	}
+}
+
+// retryableStatus reports whether a request answered with status can be sent
+// again. Idempotent methods are retried on any of the RetryableStatus codes.
+// Other methods only on 429 and 503, which reject the request before it is
+// processed, as after e.g. a 502 or 504 the upstream may have applied it.
+func (p RetryPolicy) retryableStatus(method string, status int) bool {
+	if !containsStatus(p.RetryableStatus, status) {
+		return false
+	}
+	return idempotent(method) || status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// backoff returns the wait before the attempt following attempt, doubling the
+// initial backoff each time. Half of it is randomised so that concurrent runs
+// do not retry in lockstep.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff >= p.MaxBackoff {
+			backoff = p.MaxBackoff
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryAfter returns the wait asked for by a Retry-After header, capped at
+// MaxBackoff so that a gateway cannot stall a run holding the lock.
+func (p RetryPolicy) retryAfter(header http.Header) time.Duration {
+	wait := parseRetryAfter(header)
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return wait
+}
+
+// retryableError reports whether a request failing with a connection error
+// can be sent again. Idempotent methods always can. Other methods only when
+// the request was not written, e.g. the dial or the TLS handshake failed, as
+// the gateway may otherwise have applied it already.
+func retryableError(method string, written bool) bool {
+	return idempotent(method) || !written
+}
+
+// idempotent reports whether sending a request with method twice has the same
+// effect as sending it once.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP
+// date.
+func parseRetryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:     3,
+	InitialBackoff:  time.Millisecond,
+	MaxBackoff:      time.Millisecond,
+	RetryableStatus: DefaultRetryableStatus,
+}
+
+// dropServer closes every connection after reading the request, so the
+// request has been sent but no response arrives.
+func dropServer(t *testing.T) (*atomic.Int32, *httptest.Server) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	}))
+	t.Cleanup(srv.Close)
+	return &requests, srv
+}
+
+func TestConnectionErrorAfterWrite(t *testing.T) {
+	tests := []struct {
+		method   string
+		attempts int32
+	}{
+		{method: http.MethodGet, attempts: 3},
+		{method: http.MethodPut, attempts: 3},
+		{method: http.MethodDelete, attempts: 3},
+		{method: http.MethodPost, attempts: 1},
+		{method: http.MethodPatch, attempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			requests, srv := dropServer(t)
+			client, err := NewClient("generic", srv.URL, "", WithRetryPolicy(testRetryPolicy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = client.SendRequest(context.Background(), Request{Method: tt.method, Endpoint: "/services", Body: map[string]string{"name": "a"}})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if n := requests.Load(); n != tt.attempts {
+				t.Errorf("got %d attempts, want %d", n, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestConnectionErrorBeforeWrite(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the server")
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	// The TLS handshake with a plain HTTP server fails before the request is
+	// written, so even a POST is retried.
+	client, err := NewClient("generic", strings.Replace(srv.URL, "http://", "https://", 1), "", WithRetryPolicy(testRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.SendRequest(context.Background(), Request{Method: http.MethodPost, Endpoint: "/services", Body: map[string]string{"name": "a"}})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := conns.Load(); n != 3 {
+		t.Errorf("got %d attempts, want 3", n)
+	}
+}
+
+func TestRetryableStatus(t *testing.T) {
+	tests := []struct {
+		method   string
+		status   int
+		attempts int32
+	}{
+		{method: http.MethodGet, status: http.StatusBadGateway, attempts: 3},
+		{method: http.MethodPut, status: http.StatusGatewayTimeout, attempts: 3},
+		{method: http.MethodPost, status: http.StatusBadGateway, attempts: 1},
+		{method: http.MethodPatch, status: http.StatusGatewayTimeout, attempts: 1},
+		{method: http.MethodPost, status: http.StatusServiceUnavailable, attempts: 3},
+		{method: http.MethodPatch, status: http.StatusTooManyRequests, attempts: 3},
+		{method: http.MethodGet, status: http.StatusInternalServerError, attempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %d", tt.method, tt.status), func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			client, err := NewClient("generic", srv.URL, "", WithRetryPolicy(testRetryPolicy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = client.SendRequest(context.Background(), Request{Method: tt.method, Endpoint: "/services", Body: map[string]string{"name": "a"}})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if n := requests.Load(); n != tt.attempts {
+				t.Errorf("got %d attempts, want %d", n, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxBackoff: 30 * time.Second}
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{header: "", want: 0},
+		{header: "5", want: 5 * time.Second},
+		{header: "3600", want: 30 * time.Second},
+		{header: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), want: 30 * time.Second},
+		{header: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.header != "" {
+			header.Set("Retry-After", tt.header)
+		}
+		if got := policy.retryAfter(header); got != tt.want {
+			t.Errorf("retryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+
+	if got := (RetryPolicy{}).retryAfter(http.Header{"Retry-After": {"3600"}}); got != time.Hour {
+		t.Errorf("without MaxBackoff got %s, want 1h", got)
+	}
+}
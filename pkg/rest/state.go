@@ -0,0 +1,313 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	// ErrStateNotFound is returned by a StateStore when the gateway does not
+	// hold a state record yet.
+	ErrStateNotFound = errors.New("state not found on gateway")
+	// ErrLockExists is returned by LockStore.CreateLock when the lock is held.
+	ErrLockExists = errors.New("lock already exists on gateway")
+	// ErrLockNotFound is returned by LockStore.ReadLock when no lock is held.
+	ErrLockNotFound = errors.New("lock not found on gateway")
+)
+
+// StateStore is implemented by clients that can keep the applied migration
+// ledger on the gateway itself, next to the configuration it describes.
+type StateStore interface {
+	ReadState(ctx context.Context) ([]byte, error)
+	WriteState(ctx context.Context, data []byte) error
+}
+
+// LockStore is implemented by clients that can hold an advisory lock for the
+// state stored on the gateway.
+type LockStore interface {
+	CreateLock(ctx context.Context, data []byte) error
+	ReadLock(ctx context.Context) ([]byte, error)
+	DeleteLock(ctx context.Context) error
+}
+
+const (
+	stateRecordName = "restmigrate-state"
+	lockRecordName  = "restmigrate-lock"
+	stateTag        = "restmigrate"
+
+	// kongStateConsumer owns the state plugin so it never applies to traffic.
+	kongStateConsumer = "restmigrate"
+	kongStatePluginID = "4d3c2f1e-8b7a-4c5d-9e0f-1a2b3c4d5e6f"
+)
+
+// ReadState reads the state from a disabled request-termination plugin scoped
+// to a dedicated restmigrate consumer.
+func (c *KongClient) ReadState(ctx context.Context) ([]byte, error) {
+	status, body, err := c.stateRequest(ctx, http.MethodGet, "/plugins/"+kongStatePluginID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, ErrStateNotFound
+	}
+
+	var plugin struct {
+		Config struct {
+			Body string `json:"body"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(body, &plugin); err != nil {
+		return nil, fmt.Errorf("failed to decode state plugin: %w", err)
+	}
+	if plugin.Config.Body == "" {
+		return nil, ErrStateNotFound
+	}
+	return []byte(plugin.Config.Body), nil
+}
+
+func (c *KongClient) WriteState(ctx context.Context, data []byte) error {
+	consumer := map[string]interface{}{
+		"username": kongStateConsumer,
+		"tags":     []string{stateTag},
+	}
+	if err := c.writeStateRecord(ctx, "/consumers/"+kongStateConsumer, consumer); err != nil {
+		return err
+	}
+
+	plugin := map[string]interface{}{
+		"name":          "request-termination",
+		"instance_name": stateRecordName,
+		"enabled":       false,
+		"tags":          []string{stateTag},
+		"config": map[string]interface{}{
+			"status_code":  http.StatusOK,
+			"content_type": "application/json",
+			"body":         string(data),
+		},
+	}
+	return c.writeStateRecord(ctx, fmt.Sprintf("/consumers/%s/plugins/%s", kongStateConsumer, kongStatePluginID), plugin)
+}
+
+// CreateLock creates a dedicated consumer holding the lock in its custom_id.
+// Kong rejects a duplicate username, which makes the creation atomic.
+func (c *KongClient) CreateLock(ctx context.Context, data []byte) error {
+	consumer := map[string]interface{}{
+		"username":  lockRecordName,
+		"custom_id": string(data),
+		"tags":      []string{stateTag},
+	}
+	status, _, err := c.stateRequest(ctx, http.MethodPost, "/consumers", consumer, nil)
+	if err != nil {
+		return err
+	}
+	switch {
+	case status == http.StatusConflict:
+		return ErrLockExists
+	case status < 200 || status >= 300:
+		return fmt.Errorf("failed to create lock: %w", &ErrorResponse{StatusCode: status})
+	}
+	return nil
+}
+
+func (c *KongClient) ReadLock(ctx context.Context) ([]byte, error) {
+	status, body, err := c.stateRequest(ctx, http.MethodGet, "/consumers/"+lockRecordName, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, ErrLockNotFound
+	}
+
+	var consumer struct {
+		CustomID string `json:"custom_id"`
+	}
+	if err := json.Unmarshal(body, &consumer); err != nil {
+		return nil, fmt.Errorf("failed to decode lock consumer: %w", err)
+	}
+	return []byte(consumer.CustomID), nil
+}
+
+func (c *KongClient) DeleteLock(ctx context.Context) error {
+	_, _, err := c.stateRequest(ctx, http.MethodDelete, "/consumers/"+lockRecordName, nil, nil)
+	return err
+}
+
+// ReadState reads the state from a plugin config holding a disabled
+// response-rewrite plugin. Plugin configs only apply to routes that reference
+// them, so the record never affects traffic.
+func (c *APISIXClient) ReadState(ctx context.Context) ([]byte, error) {
+	status, body, err := c.stateRequest(ctx, http.MethodGet, "/apisix/admin/plugin_configs/"+stateRecordName, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, ErrStateNotFound
+	}
+
+	var record struct {
+		Plugins map[string]struct {
+			Body string `json:"body"`
+		} `json:"plugins"`
+	}
+	if err := json.Unmarshal(unwrapAPISIXValue(body), &record); err != nil {
+		return nil, fmt.Errorf("failed to decode state plugin config: %w", err)
+	}
+	state := record.Plugins["response-rewrite"].Body
+	if state == "" {
+		return nil, ErrStateNotFound
+	}
+	return []byte(state), nil
+}
+
+func (c *APISIXClient) WriteState(ctx context.Context, data []byte) error {
+	record := map[string]interface{}{
+		"desc": "restmigrate state",
+		"labels": map[string]string{
+			"managed-by": stateTag,
+		},
+		"plugins": map[string]interface{}{
+			"response-rewrite": map[string]interface{}{
+				"_meta": map[string]interface{}{
+					"disable": true,
+				},
+				"body": string(data),
+			},
+		},
+	}
+	return c.writeStateRecord(ctx, "/apisix/admin/plugin_configs/"+stateRecordName, record)
+}
+
+// CreateLock stores the lock in a plugin config next to the state. The APISIX
+// Admin API has no create-if-absent operation, so the lock is checked before
+// it is written and is best effort only.
+func (c *APISIXClient) CreateLock(ctx context.Context, data []byte) error {
+	_, err := c.ReadLock(ctx)
+	if err == nil {
+		return ErrLockExists
+	} else if !errors.Is(err, ErrLockNotFound) {
+		return err
+	}
+
+	record := map[string]interface{}{
+		"desc": "restmigrate lock",
+		"labels": map[string]string{
+			"managed-by": stateTag,
+		},
+		"plugins": map[string]interface{}{
+			"response-rewrite": map[string]interface{}{
+				"_meta": map[string]interface{}{
+					"disable": true,
+				},
+				"body": string(data),
+			},
+		},
+	}
+	return c.writeStateRecord(ctx, "/apisix/admin/plugin_configs/"+lockRecordName, record)
+}
+
+func (c *APISIXClient) ReadLock(ctx context.Context) ([]byte, error) {
+	status, body, err := c.stateRequest(ctx, http.MethodGet, "/apisix/admin/plugin_configs/"+lockRecordName, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, ErrLockNotFound
+	}
+
+	var record struct {
+		Plugins map[string]struct {
+			Body string `json:"body"`
+		} `json:"plugins"`
+	}
+	if err := json.Unmarshal(unwrapAPISIXValue(body), &record); err != nil {
+		return nil, fmt.Errorf("failed to decode lock plugin config: %w", err)
+	}
+	return []byte(record.Plugins["response-rewrite"].Body), nil
+}
+
+func (c *APISIXClient) DeleteLock(ctx context.Context) error {
+	_, _, err := c.stateRequest(ctx, http.MethodDelete, "/apisix/admin/plugin_configs/"+lockRecordName, nil, nil)
+	return err
+}
+
+// unwrapAPISIXValue returns the object stored under value (APISIX 3) or
+// node.value (APISIX 2), or body itself when it is not wrapped.
+func unwrapAPISIXValue(body []byte) []byte {
+	var wrapper struct {
+		Value json.RawMessage `json:"value"`
+		Node  struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"node"`
+	}
+	if err := json.Unmarshal(body, &wrapper); err != nil {
+		return body
+	}
+	switch {
+	case len(wrapper.Value) > 0:
+		return wrapper.Value
+	case len(wrapper.Node.Value) > 0:
+		return wrapper.Node.Value
+	default:
+		return body
+	}
+}
+
+// writeStateRecord stores a state or lock record with PUT. Unlike for reads,
+// a 404 or 409 is an error, e.g. when the gateway lacks the resource type the
+// record is kept in, as the record would otherwise be lost silently.
+func (c *baseClient) writeStateRecord(ctx context.Context, endpoint string, record interface{}) error {
+	status, body, err := c.stateRequest(ctx, http.MethodPut, endpoint, record, nil)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		return fmt.Errorf("failed to write %s: %w", endpoint, &ErrorResponse{StatusCode: status, Body: string(body)})
+	}
+	return nil
+}
+
+// stateRequest sends a request for the state or lock record, ignoring dry run
+// mode. A 404 or 409 is returned as a status rather than an error so callers
+// can tell a missing or existing record apart from a failure.
+func (c *baseClient) stateRequest(ctx context.Context, method, endpoint string, payload interface{}, headers map[string]string) (int, []byte, error) {
+	url := fmt.Sprintf("%s%s", c.baseURL, endpoint)
+	ctx, span := otel.Tracer("restmigrate/client").Start(ctx, fmt.Sprintf("%s %s", method, endpoint))
+	defer span.End()
+
+	req, err := c.createRequest(ctx, method, url, payload, headers)
+	if err != nil {
+		return 0, nil, c.handleError(span, "Failed to create request", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, c.handleError(span, "Failed to send request", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, c.handleError(span, "Failed to read response body", err)
+	}
+
+	// The state itself is carried in the bodies, keep it out of span attributes
+	c.setSpanAttributes(span, method, url, resp.StatusCode, "")
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusConflict {
+		span.SetStatus(codes.Ok, "")
+		return resp.StatusCode, responseBody, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, responseBody, c.handleErrorResponse(span, method, url, resp.StatusCode, string(responseBody))
+	}
+
+	span.SetStatus(codes.Ok, "")
+	return resp.StatusCode, responseBody, nil
+}
@@ -0,0 +1,195 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// adminServer is an in-memory admin API storing JSON records by path. The
+// kong flag adds the Kong behaviour the state store relies on: consumers are
+// created with POST and fail with 409 on a duplicate username, and plugins
+// written below a consumer are read from /plugins.
+type adminServer struct {
+	mu      sync.Mutex
+	kong    bool
+	records map[string][]byte
+	// reject answers writes to paths with the given prefix with the status.
+	reject map[string]int
+}
+
+func newAdminServer(t *testing.T, kong bool) (*adminServer, *httptest.Server) {
+	t.Helper()
+	admin := &adminServer{kong: kong, records: make(map[string][]byte), reject: make(map[string]int)}
+	srv := httptest.NewServer(admin)
+	t.Cleanup(srv.Close)
+	return admin, srv
+}
+
+func (s *adminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	body, _ := io.ReadAll(r.Body)
+	if r.Method != http.MethodGet {
+		for prefix, status := range s.reject {
+			if strings.HasPrefix(path, prefix) {
+				w.WriteHeader(status)
+				return
+			}
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		record, ok := s.records[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !s.kong {
+			// APISIX 3 wraps the record in its etcd key and value.
+			record, _ = json.Marshal(map[string]json.RawMessage{"key": json.RawMessage(`"` + path + `"`), "value": record})
+		}
+		w.Write(record)
+	case http.MethodPost:
+		var consumer struct {
+			Username string `json:"username"`
+		}
+		json.Unmarshal(body, &consumer)
+		path += "/" + consumer.Username
+		if _, ok := s.records[path]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		s.records[path] = body
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodPut:
+		if s.kong && strings.Contains(path, "/plugins/") {
+			path = path[strings.Index(path, "/plugins/"):]
+		}
+		s.records[path] = body
+	case http.MethodDelete:
+		delete(s.records, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func testStateStore(t *testing.T, client Client) {
+	t.Helper()
+	ctx := context.Background()
+	store := client.(StateStore)
+	locks := client.(LockStore)
+
+	if _, err := store.ReadState(ctx); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("ReadState on empty gateway: got %v, want ErrStateNotFound", err)
+	}
+	if err := store.WriteState(ctx, []byte(`{"applied_migrations": []}`)); err != nil {
+		t.Fatalf("WriteState: %v", err)
+	}
+	data, err := store.ReadState(ctx)
+	if err != nil || string(data) != `{"applied_migrations": []}` {
+		t.Fatalf("ReadState: got %q, %v", data, err)
+	}
+
+	if _, err := locks.ReadLock(ctx); !errors.Is(err, ErrLockNotFound) {
+		t.Fatalf("ReadLock without lock: got %v, want ErrLockNotFound", err)
+	}
+	if err := locks.CreateLock(ctx, []byte("lock-1")); err != nil {
+		t.Fatalf("CreateLock: %v", err)
+	}
+	if err := locks.CreateLock(ctx, []byte("lock-2")); !errors.Is(err, ErrLockExists) {
+		t.Fatalf("second CreateLock: got %v, want ErrLockExists", err)
+	}
+	if data, err := locks.ReadLock(ctx); err != nil || string(data) != "lock-1" {
+		t.Fatalf("ReadLock: got %q, %v", data, err)
+	}
+	if err := locks.DeleteLock(ctx); err != nil {
+		t.Fatalf("DeleteLock: %v", err)
+	}
+	if err := locks.DeleteLock(ctx); err != nil {
+		t.Fatalf("DeleteLock of a missing lock: %v", err)
+	}
+	if err := locks.CreateLock(ctx, []byte("lock-3")); err != nil {
+		t.Fatalf("CreateLock after DeleteLock: %v", err)
+	}
+}
+
+func TestKongStateStore(t *testing.T) {
+	_, srv := newAdminServer(t, true)
+	client, err := NewClient("kong", srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStateStore(t, client)
+}
+
+func TestAPISIXStateStore(t *testing.T) {
+	_, srv := newAdminServer(t, false)
+	client, err := NewClient("apisix", srv.URL, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStateStore(t, client)
+}
+
+func TestWriteStateFailsOnRejectedRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		kong   bool
+		prefix string
+		status int
+	}{
+		// A consumer that already has a request-termination plugin.
+		{name: "kong plugin conflict", kong: true, prefix: "/consumers/restmigrate/plugins/", status: http.StatusConflict},
+		{name: "kong consumer not found", kong: true, prefix: "/consumers/", status: http.StatusNotFound},
+		// An APISIX without plugin_configs.
+		{name: "apisix without plugin configs", prefix: "/apisix/admin/plugin_configs/", status: http.StatusNotFound},
+		{name: "apisix conflict", prefix: "/apisix/admin/plugin_configs/", status: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin, srv := newAdminServer(t, tt.kong)
+			admin.reject[tt.prefix] = tt.status
+			gatewayType := "apisix"
+			if tt.kong {
+				gatewayType = "kong"
+			}
+			client, err := NewClient(gatewayType, srv.URL, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = client.(StateStore).WriteState(context.Background(), []byte(`{}`))
+			var errResp *ErrorResponse
+			if !errors.As(err, &errResp) || errResp.StatusCode != tt.status {
+				t.Errorf("WriteState: got %v, want a %d error", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestCreateLockFailsOnRejectedRecord(t *testing.T) {
+	for _, gatewayType := range []string{"kong", "apisix"} {
+		t.Run(gatewayType, func(t *testing.T) {
+			admin, srv := newAdminServer(t, gatewayType == "kong")
+			admin.reject["/"] = http.StatusNotFound
+			client, err := NewClient(gatewayType, srv.URL, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = client.(LockStore).CreateLock(context.Background(), []byte("lock-1"))
+			if err == nil || errors.Is(err, ErrLockExists) {
+				t.Errorf("CreateLock: got %v, want an error", err)
+			}
+		})
+	}
+}
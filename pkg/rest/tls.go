@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// TLSOptions configures how the client connects to admin APIs over TLS.
+type TLSOptions struct {
+	// CertFile and KeyFile hold a PEM client certificate for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// CAFile holds PEM certificates trusted in addition to the system pool.
+	CAFile string
+	// ServerName overrides the name the server certificate is verified
+	// against, e.g. when the admin API is reached by IP address.
+	ServerName string
+	// MinVersion is the minimum TLS version, 1.0 to 1.3, defaulting to 1.2.
+	MinVersion string
+	// InsecureSkipVerify disables verification of the server certificate.
+	InsecureSkipVerify bool
+}
+
+// WithTLSConfig makes the client connect with cfg instead of the default TLS
+// configuration.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *baseClient) {
+		c.tlsConfig = cfg
+	}
+}
+
+// NewHTTPClient returns an instrumented HTTP client connecting with cfg, or
+// with the default TLS configuration when cfg is nil. Everything restmigrate
+// talks to, the admin API, the OAuth2 token URL and the state store, is
+// reached through a client built here so they all trust the same CA.
+func NewHTTPClient(cfg *tls.Config) *http.Client {
+	transport := http.DefaultTransport
+	if cfg != nil {
+		custom := http.DefaultTransport.(*http.Transport).Clone()
+		custom.TLSClientConfig = cfg
+		transport = custom
+	}
+	return &http.Client{
+		Transport: otelhttp.NewTransport(transport),
+	}
+}
+
+// NewTLSConfig builds the TLS configuration for opts.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	minVersion, err := tlsVersion(opts.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         minVersion,
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, fmt.Errorf("a client certificate requires both a certificate and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+func tlsVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version: %s", version)
+	}
+}
@@ -0,0 +1,23 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// TraefikClient talks to the Traefik API, which only exposes the current
+// configuration. Reads are sent, writes fail with guidance on configuring
+// Traefik through one of its providers instead.
+type TraefikClient struct {
+	*baseClient
+}
+
+func (c *TraefikClient) SendRequest(ctx context.Context, req Request) (*Response, error) {
+	if req.Method != http.MethodGet {
+		return nil, fmt.Errorf("%w: cannot %s %s, Traefik is configured through providers, "+
+			"write the dynamic configuration to a provider it watches, e.g. the Consul or etcd KV store, "+
+			"or a file served to the HTTP provider, with --type generic", ErrReadOnly, req.Method, req.Endpoint)
+	}
+	return c.sendRequest(ctx, req)
+}
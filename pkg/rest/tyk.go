@@ -0,0 +1,37 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/krzko/restmigrate/internal/logger"
+)
+
+// TykClient talks to the Tyk Gateway API. Changes to APIs and policies only
+// take effect after a reload, so the group is reloaded after every migration
+// that wrote anything.
+type TykClient struct {
+	*baseClient
+	dirty bool
+}
+
+func (c *TykClient) SendRequest(ctx context.Context, req Request) (*Response, error) {
+	if req.Method != http.MethodGet {
+		c.dirty = true
+	}
+	return c.sendRequest(ctx, req)
+}
+
+func (c *TykClient) AfterMigration(ctx context.Context) error {
+	if !c.dirty {
+		return nil
+	}
+
+	logger.Info("Reloading Tyk gateways")
+	_, err := c.sendRequest(ctx, Request{Method: http.MethodGet, Endpoint: "/tyk/reload/group"})
+	if err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
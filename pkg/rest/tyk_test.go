@@ -0,0 +1,69 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestTykReloadsAfterWrite(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("tyk", srv.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook, ok := client.(AfterMigrationHook)
+	if !ok {
+		t.Fatal("tyk client does not implement AfterMigrationHook")
+	}
+
+	tests := []struct {
+		name    string
+		request Request
+		want    []string
+	}{
+		{
+			name:    "write",
+			request: Request{Method: http.MethodPost, Endpoint: "/tyk/apis", Body: map[string]string{"name": "api"}},
+			want:    []string{"POST /tyk/apis", "GET /tyk/reload/group"},
+		},
+		{
+			name:    "read only",
+			request: Request{Method: http.MethodGet, Endpoint: "/tyk/apis"},
+			want:    []string{"GET /tyk/apis"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			if _, err := client.SendRequest(context.Background(), tt.request); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := hook.AfterMigration(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(requests) != len(tt.want) {
+				t.Fatalf("got requests %v, want %v", requests, tt.want)
+			}
+			for i := range tt.want {
+				if requests[i] != tt.want[i] {
+					t.Errorf("request %d = %q, want %q", i, requests[i], tt.want[i])
+				}
+			}
+		})
+	}
+}